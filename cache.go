@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// cacheReservedNames are identifiers the generated caching methods declare themselves.
+var cacheReservedNames = []string{"s", "key", "values", "hit", "generation"}
+
+// makeCachedDecorators writes Cached<Name> wrappers of the interfaces in inFile, caching what
+// the All and By methods read until Store, Update, Patch or DeleteByID write. The Cache they
+// use is written to cache.go next to outFile.
+func makeCachedDecorators(inFile string, outFile string, selected []string, outPackage string) error {
+	if err := writeSupportFile(outFile, outPackage, "cache.go", cacheTemplate, newImportSet()); err != nil {
+		return err
+	}
+	return makeDecorators(inFile, outFile, selected, outPackage, buildCachedDecorator)
+}
+
+func buildCachedDecorator(i Interface) string {
+	name := decoratorName("Cached", i)
+	receiverName := name + typeParamNames(i.TypeParams)
+	ifaceType := interfaceType(i)
+
+	dec := fmt.Sprintf("// %s caches what the All and By methods of the %s it wraps read, until\n", name, i.Name)
+	dec = fmt.Sprintf("%s// Store, Update, Patch or DeleteByID change it. Cached values are shared, callers must not\n// modify them.\n", dec)
+	dec = fmt.Sprintf("%s// A read that was under way while a write went through doesn't cache what it read, it may be\n// from before the write. Writes made around other decorators sharing the cache aren't seen.\n", dec)
+	dec = fmt.Sprintf("%stype %s%s struct {\n", dec, name, typeParamDecl(i.TypeParams))
+	dec = fmt.Sprintf("%s\tnext   %s\n\tcache  Cache\n\tttl    time.Duration\n", dec, ifaceType)
+	dec = fmt.Sprintf("%s\tprefix string // of the keys i.e. IRepo[domain.Account]. for an IRepo of accounts\n\n", dec)
+	dec = fmt.Sprintf("%s\tmu         sync.Mutex\n\tgeneration uint64 // counts the writes, reads started before one don't cache\n}\n\n", dec)
+
+	dec = fmt.Sprintf("%s// New%s caches what next reads in cache for ttl.\n", dec, name)
+	dec = fmt.Sprintf("%sfunc New%s%s(next %s, cache Cache, ttl time.Duration) *%s {\n", dec, name, typeParamDecl(i.TypeParams), ifaceType, receiverName)
+	dec = fmt.Sprintf("%s%s", dec, cacheKeyPrefix(i))
+	dec = fmt.Sprintf("%s\treturn &%s{next: next, cache: cache, ttl: ttl, prefix: prefix}\n}\n", dec, receiverName)
+	dec = fmt.Sprintf("%s\n%s", dec, buildCacheHelpers(i, receiverName))
+
+	for _, m := range i.Methods {
+		m = namedResults(namedParams(m, cacheReservedNames), cacheReservedNames)
+		switch methodKindFor(m.Name) {
+		case AllMethod, ByMethod:
+			dec = fmt.Sprintf("%s\n%s", dec, buildCachedRead(i, m, receiverName))
+		case StoreMethod, UpdateMethod, DeleteMethod:
+			dec = fmt.Sprintf("%s\n%s", dec, buildCachedWrite(i, m, receiverName))
+		default:
+			dec = fmt.Sprintf("%s\n%s", dec, buildCachedForward(m, receiverName))
+		}
+	}
+	return dec
+}
+
+// cachedValues are the results of a read worth caching, all but the error.
+func cachedValues(m Method) []Param {
+	values := m.Returns
+	if _, success := errorResult(m); success {
+		values = values[:len(values)-1]
+	}
+	return values
+}
+
+func buildCachedRead(i Interface, m Method, receiverName string) string {
+	values := cachedValues(m)
+	if len(values) == 0 {
+		return buildCachedForward(m, receiverName)
+	}
+
+	// the key tells the calls apart by their arguments, the context doesn't matter
+	keyArgs := []string{"s.prefix", fmt.Sprintf("\"%s\"", m.Name)}
+	for _, p := range m.Params {
+		if p.Type != "context.Context" {
+			keyArgs = append(keyArgs, p.Name)
+		}
+	}
+
+	valueNames := []string{}
+	for _, v := range values {
+		valueNames = append(valueNames, v.Name)
+	}
+	hits := []string{}
+	for _, r := range m.Returns {
+		if err, success := errorResult(m); success && r.Name == err.Name {
+			hits = append(hits, "nil")
+		} else {
+			hits = append(hits, r.Name)
+		}
+	}
+
+	method := docComment(m.Doc, "")
+	method = fmt.Sprintf("%sfunc (s *%s) %s(%s)%s {\n", method, receiverName, m.Name, paramList(m), resultList(m.Returns, true))
+	method = fmt.Sprintf("%s\tkey := cacheKey(%s)\n", method, strings.Join(keyArgs, ", "))
+	// a value of another type than the result is a miss, as if it wasn't there
+	method = fmt.Sprintf("%s\tvalues, hit := s.get(key, %d)\n", method, len(values))
+	for idx, v := range values {
+		method = fmt.Sprintf("%s\tif hit {\n\t\t%s, hit = values[%d].(%s)\n", method, v.Name, idx, v.Type)
+		if v.Kind == GoInterface { // a nil interface was cached as nil
+			method = fmt.Sprintf("%s\t\thit = hit || values[%d] == nil\n", method, idx)
+		}
+		method = fmt.Sprintf("%s\t}\n", method)
+	}
+	method = fmt.Sprintf("%s\tif hit {\n\t\treturn %s\n\t}\n\n", method, strings.Join(hits, ", "))
+
+	method = fmt.Sprintf("%s\tgeneration := s.writes()\n", method)
+	method = fmt.Sprintf("%s\t%s = s.next.%s(%s)\n", method, returnNames(m), m.Name, argList(m))
+	if err, success := errorResult(m); success {
+		method = fmt.Sprintf("%s\tif %s == nil {\n", method, err.Name)
+		method = fmt.Sprintf("%s\t\ts.set(key, []any{%s}, generation)\n\t}\n", method, strings.Join(valueNames, ", "))
+	} else {
+		method = fmt.Sprintf("%s\ts.set(key, []any{%s}, generation)\n", method, strings.Join(valueNames, ", "))
+	}
+	method = fmt.Sprintf("%s\treturn %s\n}\n", method, returnNames(m))
+	return method
+}
+
+// buildCachedWrite drops everything cached for the interface, as any read may have changed.
+func buildCachedWrite(i Interface, m Method, receiverName string) string {
+	method := docComment(m.Doc, "")
+	method = fmt.Sprintf("%sfunc (s *%s) %s(%s)%s {\n", method, receiverName, m.Name, paramList(m), resultList(m.Returns, true))
+	if len(m.Returns) == 0 {
+		method = fmt.Sprintf("%s\ts.next.%s(%s)\n", method, m.Name, argList(m))
+		return fmt.Sprintf("%s\ts.invalidate()\n}\n", method)
+	}
+	method = fmt.Sprintf("%s\t%s = s.next.%s(%s)\n", method, returnNames(m), m.Name, argList(m))
+	method = fmt.Sprintf("%s\ts.invalidate()\n", method)
+	return fmt.Sprintf("%s\treturn %s\n}\n", method, returnNames(m))
+}
+
+// buildCacheHelpers reads what's cached and keeps reads from caching what they read while a
+// write went through. Counting the writes and dropping what's cached happen under the same
+// lock as the check of a read, so a stale value is either never set or dropped right after.
+func buildCacheHelpers(i Interface, receiverName string) string {
+	gen := "// get finds the n values cached under key.\n"
+	gen = fmt.Sprintf("%sfunc (s *%s) get(key string, n int) ([]any, bool) {\n", gen, receiverName)
+	gen = fmt.Sprintf("%s\tcached, ok := s.cache.Get(key)\n\tif !ok {\n\t\treturn nil, false\n\t}\n", gen)
+	gen = fmt.Sprintf("%s\tvalues, ok := cached.([]any)\n\treturn values, ok && len(values) == n\n}\n\n", gen)
+	gen = fmt.Sprintf("%s// writes is how many writes went through, for a read to tell whether one did while it read.\n", gen)
+	gen = fmt.Sprintf("%sfunc (s *%s) writes() uint64 {\n\ts.mu.Lock()\n\tdefer s.mu.Unlock()\n\treturn s.generation\n}\n\n", gen, receiverName)
+	gen = fmt.Sprintf("%s// set caches values under key, unless a write went through since generation.\n", gen)
+	gen = fmt.Sprintf("%sfunc (s *%s) set(key string, values []any, generation uint64) {\n", gen, receiverName)
+	gen = fmt.Sprintf("%s\ts.mu.Lock()\n\tdefer s.mu.Unlock()\n\tif s.generation == generation {\n\t\ts.cache.Set(key, values, s.ttl)\n\t}\n}\n\n", gen)
+	gen = fmt.Sprintf("%s// invalidate counts a write and drops everything cached for %s.\n", gen, i.Name)
+	gen = fmt.Sprintf("%sfunc (s *%s) invalidate() {\n\ts.mu.Lock()\n\tdefer s.mu.Unlock()\n\ts.generation++\n", gen, receiverName)
+	return fmt.Sprintf("%s\ts.cache.DeletePrefix(s.prefix)\n}\n", gen)
+}
+
+// cacheKeyPrefix declares the prefix of the keys of the decorator of i. A generic interface
+// has its type arguments in there, so instantiations sharing a cache don't read each other's
+// values.
+func cacheKeyPrefix(i Interface) string {
+	if len(i.TypeParams) == 0 {
+		return fmt.Sprintf("\tprefix := \"%s.\"\n", i.Name)
+	}
+	typeArgs := []string{}
+	for _, tp := range i.TypeParams {
+		typeArgs = append(typeArgs, fmt.Sprintf("reflect.TypeOf((*%s)(nil)).Elem().String()", tp.Name))
+	}
+	return fmt.Sprintf("\tprefix := \"%s[\" + %s + \"].\"\n", i.Name, strings.Join(typeArgs, " + \", \" + "))
+}
+
+func buildCachedForward(m Method, receiverName string) string {
+	method := docComment(m.Doc, "")
+	method = fmt.Sprintf("%sfunc (s *%s) %s(%s)%s {\n", method, receiverName, m.Name, paramList(m), resultList(m.Returns, true))
+	if len(m.Returns) == 0 {
+		return fmt.Sprintf("%s\ts.next.%s(%s)\n}\n", method, m.Name, argList(m))
+	}
+	return fmt.Sprintf("%s\treturn s.next.%s(%s)\n}\n", method, m.Name, argList(m))
+}
+
+const cacheTemplate = `// Cache keeps what cached decorators read, under keys made of the interface, method and
+// arguments i.e. IAccountRepo.ByID("42")
+type Cache interface {
+	Get(key string) (any, bool)
+	Set(key string, value any, ttl time.Duration)
+	DeletePrefix(prefix string)
+}
+
+// cacheKey is the key of a call to method with args. Pointers among the args are followed, so
+// calls with equal values share a key whatever their addresses.
+func cacheKey(prefix string, method string, args ...any) string {
+	key := prefix + method + "("
+	for idx, arg := range args {
+		if idx > 0 {
+			key += ", "
+		}
+		v := reflect.ValueOf(arg)
+		for v.Kind() == reflect.Pointer && !v.IsNil() {
+			v = v.Elem()
+		}
+		if v.IsValid() {
+			key += fmt.Sprintf("%#v", v.Interface())
+		} else {
+			key += "nil"
+		}
+	}
+	return key + ")"
+}
+
+// MemoryCache is a Cache in memory. Entries set with a ttl of 0 never expire.
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]memoryCacheEntry
+}
+
+type memoryCacheEntry struct {
+	value   any
+	expires time.Time
+}
+
+// NewMemoryCache returns an empty cache.
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{entries: map[string]memoryCacheEntry{}}
+}
+
+func (c *MemoryCache) Get(key string) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (c *MemoryCache) Set(key string, value any, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := memoryCacheEntry{value: value}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+	c.entries[key] = entry
+}
+
+func (c *MemoryCache) DeletePrefix(prefix string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(c.entries, key)
+		}
+	}
+}
+`
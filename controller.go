@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
 	"strings"
 	"unicode"
@@ -36,25 +35,56 @@ func description(controllerName string) string {
 	return desc
 }
 
-func makeController(controllerName string, outdir string) {
-	// input := modelFile
-	// output := serviceFile
+// handler is an action of a generated controller and the route it answers.
+type handler struct {
+	Method string // of the request i.e. Post
+	Path   string // after the version of the api i.e. /%route%/:id
+	Name   string
+	Doc    string
+	Body   string
+
+	Service Method // the handler calls
+	Status  string // answering a request that succeeds i.e. http.StatusOK
+	Parses  bool   // the body of the request
+}
+
+// controllerSpec is what a controller is generated from, whatever router it's for.
+type controllerSpec struct {
+	Name    string    // of the controller i.e. ResourcePolicy
+	Service Interface // the controller calls i.e. logic.IResourcePolicyService
+	Router  routerTarget
+}
+
+// makeController writes a controller answering requests through the service interface in
+// serviceFile, as generated by rawdog -s, with its routes added to the router called
+// routerName. Without serviceFile the controller expects the service rawdog -s generates from
+// queries without contexts.
+func makeController(controllerName string, outdir string, serviceFile string, routerName string) error {
 	rt := route(controllerName, "-")
 	desc := description(controllerName)
 	fileName := route(controllerName, "_")
+	output := filepath.Join(outdir, fileName+".go")
+
+	target, err := findRouterTarget(routerName)
+	if err != nil {
+		return err
+	}
+	svc, imports, err := controllerService(controllerName, serviceFile, output)
+	if err != nil {
+		return err
+	}
+	if target.Package != "" {
+		imports.add(target.Package, target.ImportPath)
+	}
+	spec := controllerSpec{Name: controllerName, Service: svc, Router: target}
+	handlers, err := controllerHandlers(spec)
+	if err != nil {
+		return err
+	}
 
 	ctrlTemplate := `
 	package controller
 
-	import (
-		"lib/router"
-		"log"
-		"net/http"
-
-		"app/webapi/logic"
-		"domain"
-	)
-
 	// %ctrl_name% represents the services required for this controller.
 	type %ctrl_name% struct {
 		%ctrl_name% logic.I%ctrl_name%Service
@@ -72,40 +102,527 @@ func makeController(controllerName string, outdir string) {
 	}
 
 	// AddRoutes adds routes for interacting with domain %ctrl_name% via the webapi.
-	func (h *%ctrl_name%) AddRoutes() {
-		router.Post(APIV1+"/%route%", h.Store)
-		router.Get(APIV1+"/%route%", h.Index)
-		router.Get(APIV1+"/%route%/:id", h.Show)
+	func (h *%ctrl_name%) AddRoutes(%receiver%) {
+%routes%	}
+	`
+
+	routes := ""
+	for _, hd := range handlers {
+		routes = fmt.Sprintf("%s\t\t%s\n", routes, target.Route(hd.Method, hd.Path, hd.Name))
+	}
+	ctrl := strings.Replace(ctrlTemplate, "%routes%", routes, -1)
+	ctrl = strings.Replace(ctrl, "%receiver%", target.Receiver, -1)
+	for _, hd := range handlers {
+		ctrl = fmt.Sprintf("%s\n%sfunc (h *%%ctrl_name%%) %s(w http.ResponseWriter, r *http.Request) {\n%s}\n", ctrl, hd.Doc, hd.Name, hd.Body)
 	}
 
-	// Store saves a new %ctrl_name% to the database.
-	func (h *%ctrl_name%) Store(w http.ResponseWriter, r *http.Request) {
+	ctrl = strings.Replace(ctrl, "%ctrl_name%", controllerName, -1)
+	ctrl = strings.Replace(ctrl, "%route%", rt, -1)
+	ctrl = strings.Replace(ctrl, "%desc%", desc, -1)
+
+	if err := writeSupportFile(output, "controller", "render.go", renderTemplate, newControllerImports()); err != nil {
+		return err
+	}
+	if err := writeGoFile(output, ctrl, imports); err != nil {
+		return err
+	}
 
+	testFile := strings.TrimSuffix(output, ".go") + "_test.go"
+	if handWritten(testFile) {
+		fmt.Printf("WARNING: %s wasn't generated by rawdog, not overwriting it\n", testFile)
+		return nil
 	}
+	if err := writeSupportFile(testFile, "controller", "render_test.go", renderTestTemplate, newControllerImports()); err != nil {
+		return err
+	}
+	tests := fmt.Sprintf("// Generated by Rawdog\n\npackage controller\n\n%s", ControllerTests(spec, handlers))
+	tests = strings.Replace(tests, "%ctrl_name%", controllerName, -1)
+	tests = strings.Replace(tests, "%route%", rt, -1)
+	return writeGoFile(testFile, tests, imports)
+}
 
-	// Index shows all %ctrl_name% in the system.
-	func (h *%ctrl_name%) Index(w http.ResponseWriter, r *http.Request) {
+func newControllerImports() *importSet {
+	imports := newImportSet()
+	imports.addAll(appImports)
+	return imports
+}
 
+// controllerService finds the service interface of the controller in serviceFile, or makes up
+// the one rawdog -s generates when there's no serviceFile.
+func controllerService(controllerName string, serviceFile string, output string) (Interface, *importSet, error) {
+	svcName := "I" + controllerName + "Service"
+	if serviceFile == "" {
+		item := "domain." + controllerName
+		svc := Interface{Name: svcName, Package: "logic", Methods: []Method{
+			{Name: "All", Returns: []Param{{Type: "[]" + item, Kind: Slice}, {Type: "error", Kind: GoInterface}}},
+			{Name: "ByID", Params: []Param{{Name: "id", Type: "string"}}, Returns: []Param{{Type: "*" + item, Kind: Pointer}, {Type: "error", Kind: GoInterface}}},
+			{Name: "Store", Params: []Param{{Name: "item", Type: "*" + item, Kind: Pointer}}, Returns: []Param{{Type: "*" + item, Kind: Pointer}, {Type: "error", Kind: GoInterface}}},
+			{Name: "Update", Params: []Param{{Name: "id", Type: "string"}, {Name: "item", Type: "*" + item, Kind: Pointer}}, Returns: []Param{{Type: "*" + item, Kind: Pointer}, {Type: "error", Kind: GoInterface}}},
+			{Name: "Patch", Params: []Param{{Name: "id", Type: "string"}, {Name: "fields", Type: "map[string]interface{}", Kind: Map}}, Returns: []Param{{Type: "*" + item, Kind: Pointer}, {Type: "error", Kind: GoInterface}}},
+			{Name: "DeleteByID", Params: []Param{{Name: "id", Type: "string"}}, Returns: []Param{{Type: "error", Kind: GoInterface}}},
+		}}
+		return svc, newControllerImports(), nil
 	}
 
-	// Show returns a particular %ctrl_name% with a particular ID in the system.
-	func (h *%ctrl_name%) Show(w http.ResponseWriter, r *http.Request) {
-		id := router.Param(r, "id")
+	interfaces, imports, _, err := fileInterfaces(serviceFile, output, "controller")
+	if err != nil {
+		return Interface{}, nil, err
+	}
+	imports.addAll(appImports)
+	for _, i := range interfaces {
+		if i.Name == svcName {
+			return i, imports, nil
+		}
+	}
+	return Interface{}, nil, fmt.Errorf("%s has no interface %s", serviceFile, svcName)
+}
 
+// findMethod finds the method of i called name.
+func findMethod(i Interface, name string) (Method, bool) {
+	for _, m := range i.Methods {
+		if m.Name == name {
+			return m, true
+		}
 	}
-	`
+	return Method{}, false
+}
 
-	ctrl := strings.Replace(ctrlTemplate, "%ctrl_name%", controllerName, -1)
-	ctrl = strings.Replace(ctrl, "%route%", rt, -1)
-	ctrl = strings.Replace(ctrl, "%desc%", desc, -1)
+// handlerBuilders make the actions of a controller from the service methods they call, in the
+// order of the routes.
+var handlerBuilders = []struct {
+	Method string
+	Build  func(c controllerSpec, m Method) (handler, error)
+}{
+	{"Store", storeHandler},
+	{"All", indexHandler},
+	{"ByID", showHandler},
+	{"Update", updateHandler},
+	{"Patch", patchHandler},
+	{"DeleteByID", destroyHandler},
+}
 
-	output := filepath.Join(outdir, fileName+".go")
-	file, err := os.Create(output)
+// controllerHandlers makes the actions for the methods the service has.
+func controllerHandlers(c controllerSpec) ([]handler, error) {
+	handlers := []handler{}
+	for _, builder := range handlerBuilders {
+		m, success := findMethod(c.Service, builder.Method)
+		if !success {
+			continue
+		}
+		hd, err := builder.Build(c, m)
+		if err != nil {
+			return nil, err
+		}
+		handlers = append(handlers, hd)
+	}
+	for _, m := range c.Service.Methods {
+		if !isForeignKeyMethod(m) {
+			continue
+		}
+		hd, err := foreignKeyHandler(c, m)
+		if err != nil {
+			return nil, err
+		}
+		handlers = append(handlers, hd)
+	}
+	return handlers, nil
+}
+
+// isForeignKeyMethod reports whether m reads the records by a foreign key i.e. ByOrgID, as
+// generated for the _id columns of the model.
+func isForeignKeyMethod(m Method) bool {
+	return methodKindFor(m.Name) == ByMethod && m.Name != "ByID" && strings.HasSuffix(m.Name, "ID")
+}
+
+// serviceCall calls m on the service of the controller with the context of the request and
+// args for its other params i.e. h.Account.ByID(r.Context(), id)
+func serviceCall(controllerName string, m Method, args ...string) (string, error) {
+	callArgs := []string{}
+	for _, p := range m.Params {
+		if p.Type == "context.Context" {
+			callArgs = append(callArgs, "r.Context()")
+			continue
+		}
+		if len(args) == 0 {
+			return "", fmt.Errorf("I%sService.%s takes more params than the controller can fill", controllerName, m.Name)
+		}
+		callArgs = append(callArgs, args[0])
+		args = args[1:]
+	}
+	if len(args) > 0 {
+		return "", fmt.Errorf("I%sService.%s takes fewer params than the controller passes", controllerName, m.Name)
+	}
+	return fmt.Sprintf("h.%s.%s(%s)", controllerName, m.Name, strings.Join(callArgs, ", ")), nil
+}
+
+// serviceResult assigns what the service call returns to name and err, and answers with the
+// status of the error if there is one. Methods that only return an error assign just err.
+func serviceResult(controllerName string, m Method, name string, call string) (string, bool, error) {
+	if _, success := errorResult(m); !success || len(m.Returns) > 2 {
+		return "", false, fmt.Errorf("I%sService.%s has to return an error, after at most one value", controllerName, m.Name)
+	}
+	body := fmt.Sprintf("\t%s, err := %s\n", name, call)
+	if len(m.Returns) == 1 {
+		body = fmt.Sprintf("\terr := %s\n", call)
+	}
+	body = fmt.Sprintf("%s\tif err != nil {\n\t\trenderError(h.View, w, err)\n\t\treturn\n\t}\n", body)
+	return body, len(m.Returns) == 2, nil
+}
+
+// varName is the Go name of a param of a route i.e. orgID for org_id
+func varName(param string) string {
+	words := strings.Split(param, "_")
+	for i, word := range words[1:] {
+		if word == "id" {
+			words[i+1] = "ID"
+		} else if word != "" {
+			words[i+1] = strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return strings.Join(words, "")
+}
+
+// pathParam declares the variable of the param of the route, read through the router of the
+// controller and converted to the type of p. The error of the conversion gets a name of its
+// own, the handlers declare err for the service call after it.
+func pathParam(c controllerSpec, param string, p Param) (string, error) {
+	name := varName(param)
+	value := c.Router.Param(param)
+	if p.Type == "string" {
+		return fmt.Sprintf("\t%s := %s\n", name, value), nil
+	}
+	parse, success := pathParamParsers[p.Type]
+	if !success {
+		return "", fmt.Errorf("the controller can't read a %s from the path for %s, the ids of I%sService have to be strings or integers", p.Type, param, c.Name)
+	}
+
+	// strconv parses into int64 or uint64, within the bits of the other types
+	parsed := name
+	if p.Type != "int" && p.Type != "int64" && p.Type != "uint64" {
+		parsed = name + "64"
+	}
+	body := fmt.Sprintf("\t%s, %sErr := %s\n", parsed, name, fmt.Sprintf(parse, value))
+	body = fmt.Sprintf("%s\tif %sErr != nil {\n\t\trenderStatus(h.View, w, http.StatusBadRequest, %sErr)\n\t\treturn\n\t}\n", body, name, name)
+	if parsed != name {
+		body = fmt.Sprintf("%s\t%s := %s(%s)\n", body, name, p.Type, parsed)
+	}
+	return body, nil
+}
+
+// pathParamParsers read the integer types ids can have from the path, by type.
+var pathParamParsers = map[string]string{
+	"int":    "strconv.Atoi(%s)",
+	"int8":   "strconv.ParseInt(%s, 10, 8)",
+	"int16":  "strconv.ParseInt(%s, 10, 16)",
+	"int32":  "strconv.ParseInt(%s, 10, 32)",
+	"int64":  "strconv.ParseInt(%s, 10, 64)",
+	"uint":   "strconv.ParseUint(%s, 10, 0)",
+	"uint8":  "strconv.ParseUint(%s, 10, 8)",
+	"uint16": "strconv.ParseUint(%s, 10, 16)",
+	"uint32": "strconv.ParseUint(%s, 10, 32)",
+	"uint64": "strconv.ParseUint(%s, 10, 64)",
+}
+
+// bodyParam declares name from the body of the request, parsed into the type of p.
+func bodyParam(name string, p Param) string {
+	body := ""
+	switch p.Kind {
+	case Pointer:
+		body = fmt.Sprintf("\t%s := new(%s)\n", name, strings.TrimPrefix(p.Type, "*"))
+		body = fmt.Sprintf("%s\tif err := h.Parser.Parse(r, %s); err != nil {\n", body, name)
+	case Map:
+		body = fmt.Sprintf("\t%s := %s{}\n", name, p.Type)
+		body = fmt.Sprintf("%s\tif err := h.Parser.Parse(r, &%s); err != nil {\n", body, name)
+	default:
+		body = fmt.Sprintf("\tvar %s %s\n", name, p.Type)
+		body = fmt.Sprintf("%s\tif err := h.Parser.Parse(r, &%s); err != nil {\n", body, name)
+	}
+	return fmt.Sprintf("%s\t\trenderStatus(h.View, w, http.StatusBadRequest, err)\n\t\treturn\n\t}\n", body)
+}
+
+// readResult calls the read m with args and answers with what it returns, not found when it
+// returns no record.
+func readResult(controllerName string, m Method, name string, args ...string) (string, error) {
+	call, err := serviceCall(controllerName, m, args...)
+	if err != nil {
+		return "", err
+	}
+	body, hasValue, err := serviceResult(controllerName, m, name, call)
+	if err != nil {
+		return "", err
+	}
+	if !hasValue {
+		return "", fmt.Errorf("I%sService.%s has to return what it reads", controllerName, m.Name)
+	}
+	if m.Returns[0].Kind == Pointer {
+		body = fmt.Sprintf("%s\tif %s == nil {\n\t\trenderStatus(h.View, w, http.StatusNotFound, nil)\n\t\treturn\n\t}\n", body, name)
+	}
+	return fmt.Sprintf("%s\th.View.JSON(w, http.StatusOK, %s)\n", body, name), nil
+}
+
+// augmentableResult is the readResult of m, or of its Augmented counterpart for requests asking
+// for ?augmented=true when the service has one.
+func augmentableResult(c controllerSpec, m Method, name string, args ...string) (string, error) {
+	body, err := readResult(c.Name, m, name, args...)
+	if err != nil {
+		return "", err
+	}
+	augmented, success := findMethod(c.Service, m.Name+"Augmented")
+	if !success {
+		return body, nil
+	}
+	augmentedBody, err := readResult(c.Name, augmented, name, args...)
+	if err != nil {
+		return "", err
+	}
+	augmentedBody = strings.Replace(augmentedBody, "\n\t", "\n\t\t", -1)
+	return fmt.Sprintf("\tif r.URL.Query().Get(\"augmented\") == \"true\" {\n\t%s\t\treturn\n\t}\n\n%s", augmentedBody, body), nil
+}
+
+// nonContextParams are the params of m the controller has to fill.
+func nonContextParams(m Method) []Param {
+	params := []Param{}
+	for _, p := range m.Params {
+		if p.Type != "context.Context" {
+			params = append(params, p)
+		}
+	}
+	return params
+}
+
+func storeHandler(c controllerSpec, m Method) (handler, error) {
+	params := nonContextParams(m)
+	if len(params) != 1 {
+		return handler{}, fmt.Errorf("I%sService.Store has to take the item to store", c.Name)
+	}
+
+	body := fmt.Sprintf("%s\n", bodyParam("item", params[0]))
+
+	call, err := serviceCall(c.Name, m, "item")
+	if err != nil {
+		return handler{}, err
+	}
+	result, hasValue, err := serviceResult(c.Name, m, "created", call)
+	if err != nil {
+		return handler{}, err
+	}
+	body = fmt.Sprintf("%s%s", body, result)
+	if hasValue {
+		body = fmt.Sprintf("%s\th.View.JSON(w, http.StatusCreated, created)\n", body)
+	} else {
+		body = fmt.Sprintf("%s\th.View.JSON(w, http.StatusCreated, item)\n", body)
+	}
+
+	doc := "// Store saves a new %ctrl_name% to the database.\n"
+	hd := handler{Method: "Post", Path: "/%route%", Name: "Store", Doc: doc, Body: body}
+	hd.Service, hd.Status, hd.Parses = m, "http.StatusCreated", true
+	return hd, nil
+}
+
+func indexHandler(c controllerSpec, m Method) (handler, error) {
+	body, err := augmentableResult(c, m, "items")
+	if err != nil {
+		return handler{}, err
+	}
+
+	doc := "// Index shows all %ctrl_name% in the system.\n"
+	hd := handler{Method: "Get", Path: "/%route%", Name: "Index", Doc: doc, Body: body}
+	hd.Service, hd.Status = m, "http.StatusOK"
+	return hd, nil
+}
+
+func showHandler(c controllerSpec, m Method) (handler, error) {
+	params := nonContextParams(m)
+	if len(params) != 1 {
+		return handler{}, fmt.Errorf("I%sService.ByID has to take the id", c.Name)
+	}
+	id, err := pathParam(c, "id", params[0])
+	if err != nil {
+		return handler{}, err
+	}
+	result, err := augmentableResult(c, m, "item", "id")
+	if err != nil {
+		return handler{}, err
+	}
+	body := fmt.Sprintf("%s\n%s", id, result)
+
+	doc := "// Show returns a particular %ctrl_name% with a particular ID in the system.\n"
+	hd := handler{Method: "Get", Path: "/%route%/:id", Name: "Show", Doc: doc, Body: body}
+	hd.Service, hd.Status = m, "http.StatusOK"
+	return hd, nil
+}
+
+// foreignKeyHandler answers the route nested under the record the foreign key of m points to
+// i.e. /org/:org_id/%route% for ByOrgID
+func foreignKeyHandler(c controllerSpec, m Method) (handler, error) {
+	params := nonContextParams(m)
+	if len(params) != 1 {
+		return handler{}, fmt.Errorf("I%sService.%s has to take the foreign key", c.Name, m.Name)
+	}
+	key := params[0].Name
+	parent := strings.TrimSuffix(strings.TrimPrefix(m.Name, "By"), "ID")
+	keyParam, err := pathParam(c, key, params[0])
+	if err != nil {
+		return handler{}, err
+	}
+	result, err := augmentableResult(c, m, "items", varName(key))
+	if err != nil {
+		return handler{}, err
+	}
+	body := fmt.Sprintf("%s\n%s", keyParam, result)
+
+	name := "Index" + m.Name
+	doc := fmt.Sprintf("// %s shows all %%ctrl_name%% of a particular %s.\n", name, description(parent))
+	path := fmt.Sprintf("/%s/:%s/%%route%%", route(parent, "-"), key)
+	hd := handler{Method: "Get", Path: path, Name: name, Doc: doc, Body: body}
+	hd.Service, hd.Status = m, "http.StatusOK"
+	return hd, nil
+}
+
+// changeHandler answers a request to change the record with the id of the route, parsing the
+// change from the body into name. convert is run on the change before the service gets it.
+func changeHandler(c controllerSpec, m Method, name string, convert string) (handler, error) {
+	params := nonContextParams(m)
+	if len(params) != 2 {
+		return handler{}, fmt.Errorf("I%sService.%s has to take the id and the change", c.Name, m.Name)
+	}
+	id, err := pathParam(c, "id", params[0])
+	if err != nil {
+		return handler{}, err
+	}
+	body := fmt.Sprintf("%s%s%s\n", id, bodyParam(name, params[1]), convert)
+
+	call, err := serviceCall(c.Name, m, "id", name)
+	if err != nil {
+		return handler{}, err
+	}
+	result, hasValue, err := serviceResult(c.Name, m, "changed", call)
+	if err != nil {
+		return handler{}, err
+	}
+	body = fmt.Sprintf("%s%s", body, result)
+	status := "http.StatusOK"
+	if hasValue {
+		body = fmt.Sprintf("%s\th.View.JSON(w, http.StatusOK, changed)\n", body)
+	} else {
+		status = "http.StatusNoContent"
+		body = fmt.Sprintf("%s\tw.WriteHeader(http.StatusNoContent)\n", body)
+	}
+	return handler{Path: "/%route%/:id", Body: body, Service: m, Status: status, Parses: true}, nil
+}
+
+func updateHandler(c controllerSpec, m Method) (handler, error) {
+	hd, err := changeHandler(c, m, "item", "")
+	hd.Method = "Put"
+	hd.Name = "Update"
+	hd.Doc = "// Update replaces a particular %ctrl_name% with a particular ID in the system.\n"
+	return hd, err
+}
+
+func patchHandler(c controllerSpec, m Method) (handler, error) {
+	// the body names the fields as JSON does, like the bodies of Store and Update
+	hd, err := changeHandler(c, m, "fields", "\tfields = patchFields(fields, domain.%ctrl_name%{})\n")
+	hd.Method = "Patch"
+	hd.Name = "Patch"
+	hd.Doc = "// Patch changes the fields in the request of a particular %ctrl_name% with a particular ID.\n"
+	hd.Doc = fmt.Sprintf("%s// The fields go by their json names, as in the bodies of Store and Update.\n", hd.Doc)
+	return hd, err
+}
+
+func destroyHandler(c controllerSpec, m Method) (handler, error) {
+	params := nonContextParams(m)
+	if len(params) != 1 {
+		return handler{}, fmt.Errorf("I%sService.DeleteByID has to take the id", c.Name)
+	}
+	id, err := pathParam(c, "id", params[0])
+	if err != nil {
+		return handler{}, err
+	}
+	body := fmt.Sprintf("%s\n", id)
+
+	call, err := serviceCall(c.Name, m, "id")
+	if err != nil {
+		return handler{}, err
+	}
+	result, _, err := serviceResult(c.Name, m, "_", call)
 	if err != nil {
-		fmt.Printf("ERROR: %v\n", err)
-		return
+		return handler{}, err
 	}
-	defer file.Close()
+	body = fmt.Sprintf("%s%s\tw.WriteHeader(http.StatusNoContent)\n", body, result)
 
-	file.WriteString(ctrl)
+	doc := "// Destroy deletes a particular %ctrl_name% with a particular ID from the system.\n"
+	hd := handler{Method: "Delete", Path: "/%route%/:id", Name: "Destroy", Doc: doc, Body: body}
+	hd.Service, hd.Status = m, "http.StatusNoContent"
+	return hd, nil
+}
+
+const renderTemplate = `// statusFor is the status answering a request the service failed with err: 404 Not Found
+// when the record doesn't exist, 400 Bad Request when the input isn't valid and 500 Internal
+// Server Error otherwise. Services tell them apart with sql.ErrNoRows, or errors that have a
+// NotFound or Invalid method returning true.
+func statusFor(err error) int {
+	var notFound interface{ NotFound() bool }
+	var invalid interface{ Invalid() bool }
+	switch {
+	case errors.Is(err, sql.ErrNoRows), errors.As(err, &notFound) && notFound.NotFound():
+		return http.StatusNotFound
+	case errors.As(err, &invalid) && invalid.Invalid():
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// renderError answers a request the service failed with err.
+func renderError(view domain.IViewAdapter, w http.ResponseWriter, err error) {
+	renderStatus(view, w, statusFor(err), err)
+}
+
+// renderStatus answers with status and a message. Only bad requests get the message of err,
+// for the client to fix them, the others could give away how the server works.
+func renderStatus(view domain.IViewAdapter, w http.ResponseWriter, status int, err error) {
+	message := http.StatusText(status)
+	if status == http.StatusBadRequest && err != nil {
+		message = err.Error()
+	}
+	view.JSON(w, status, map[string]string{"error": message})
+}
+
+// patchFields renames the keys of a PATCH body from the json names of the fields of item, the
+// names POST and PUT bodies use, to the field names the Patch of the services takes. Like
+// encoding/json, a key matching no json name exactly may match one regardless of case. Keys
+// no field goes by are left for the service to reject.
+func patchFields(fields map[string]interface{}, item interface{}) map[string]interface{} {
+	names := map[string]string{}
+	for _, field := range reflect.VisibleFields(reflect.TypeOf(item)) {
+		if field.Anonymous || !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names[name] = field.Name
+	}
+
+	renamed := map[string]interface{}{}
+	for key, value := range fields {
+		renamed[patchFieldName(names, key)] = value
+	}
+	return renamed
+}
+
+func patchFieldName(names map[string]string, key string) string {
+	if name, ok := names[key]; ok {
+		return name
+	}
+	for jsonName, name := range names {
+		if strings.EqualFold(jsonName, key) {
+			return name
+		}
+	}
+	return key
 }
+`
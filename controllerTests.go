@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// pathParamSample is the value the generated tests put in the params of the paths.
+const pathParamSample = "42"
+
+// ControllerTests send requests to every route of the controller through its router, with a
+// mock of the service behind it: one that succeeds, one for a record that isn't there, one
+// with a body that isn't JSON and one the service fails.
+func ControllerTests(c controllerSpec, handlers []handler) string {
+	// buildMock names the params and results of the methods it's given in place, the calls
+	// the tests check are recorded under those names. The mock is unexported so it can't clash
+	// with one rawdog -m writes to the package
+	methods := append([]Method(nil), c.Service.Methods...)
+	svc := Interface{Name: c.Service.Name, Methods: methods, MockName: "test" + c.Service.Name}
+	tests := buildMock(svc, MockOptions{})
+	tests = fmt.Sprintf("%s\n%s", tests, serveRoutes(c))
+
+	for _, hd := range handlers {
+		m, _ := findMethod(svc, hd.Service.Name)
+		tests = fmt.Sprintf("%s\n%s", tests, RouteTest(c, svc, hd, m, ""))
+		if len(pathParamNames(hd.Path)) > 0 {
+			tests = fmt.Sprintf("%s\n%s", tests, RouteTest(c, svc, hd, m, "NotFound"))
+		}
+		if hd.Parses {
+			tests = fmt.Sprintf("%s\n%s", tests, RouteTest(c, svc, hd, m, "BadJSON"))
+		}
+		tests = fmt.Sprintf("%s\n%s", tests, RouteTest(c, svc, hd, m, "Error"))
+	}
+	return tests
+}
+
+// serveRoutes answers a request with the routes of the controller, calling svc. A package level
+// router gets the routes once, the controller behind them is given svc for every request.
+func serveRoutes(c controllerSpec) string {
+	serve := fmt.Sprintf("// serve%s answers req with the routes of a %s controller calling svc.\n", c.Name, c.Name)
+	if c.Router.NewRouter == "" {
+		routes := lowerFirst(c.Name) + "Routes"
+		serve = fmt.Sprintf("// %s is the controller behind the routes added to the router, once.\nvar %s struct {\n\tonce sync.Once\n\th    *%s\n}\n\n%s", routes, routes, c.Name, serve)
+		serve = fmt.Sprintf("%sfunc serve%s(svc logic.%s, req *http.Request) *httptest.ResponseRecorder {\n", serve, c.Name, c.Service.Name)
+		serve = fmt.Sprintf("%s\t%s.once.Do(func() {\n\t\t%s.h = New%s(svc, testView{}, testParser{})\n\t\t%s.h.AddRoutes()\n\t})\n", serve, routes, routes, c.Name, routes)
+		serve = fmt.Sprintf("%s\t%s.h.%s = svc\n\n", serve, routes, c.Name)
+		serve = fmt.Sprintf("%s\tw := httptest.NewRecorder()\n\t%s.ServeHTTP(w, req)\n\treturn w\n}\n", serve, c.Router.Instance)
+		return serve
+	}
+
+	receiver := strings.Fields(c.Router.Receiver)[0]
+	serve = fmt.Sprintf("%sfunc serve%s(svc logic.%s, req *http.Request) *httptest.ResponseRecorder {\n", serve, c.Name, c.Service.Name)
+	serve = fmt.Sprintf("%s\t%s := %s\n", serve, receiver, c.Router.NewRouter)
+	serve = fmt.Sprintf("%s\tNew%s(svc, testView{}, testParser{}).AddRoutes(%s)\n\n", serve, c.Name, receiver)
+	serve = fmt.Sprintf("%s\tw := httptest.NewRecorder()\n\t%s.ServeHTTP(w, req)\n\treturn w\n}\n", serve, receiver)
+	return serve
+}
+
+// RouteTest sends a request to the route of hd, answered by the service method m of the mock.
+// failure picks what goes wrong: "" for nothing, NotFound for a service that finds no record,
+// BadJSON for a body that doesn't parse and Error for a service that fails.
+func RouteTest(c controllerSpec, svc Interface, hd handler, m Method, failure string) string {
+	testName := fmt.Sprintf("Test%s%s%s", c.Name, hd.Name, failure)
+	route := fmt.Sprintf("%s %s", strings.ToUpper(hd.Method), hd.Path)
+	status := hd.Status
+	doc := fmt.Sprintf("// %s checks %s passes the params of its path to %s and answers %s.\n", testName, route, m.Name, httpStatusText(status))
+	if len(pathParamNames(hd.Path)) == 0 {
+		doc = fmt.Sprintf("// %s checks %s calls %s and answers %s.\n", testName, route, m.Name, httpStatusText(status))
+	}
+	errDecl := "\tvar wantErr error\n"
+	switch failure {
+	case "NotFound":
+		status = "http.StatusNotFound"
+		doc = fmt.Sprintf("// %s checks %s answers %s when %s finds no record.\n", testName, route, httpStatusText(status), m.Name)
+		errDecl = "\twantErr := sql.ErrNoRows\n"
+	case "BadJSON":
+		status = "http.StatusBadRequest"
+		doc = fmt.Sprintf("// %s checks %s answers %s without calling %s when the body isn't JSON.\n", testName, route, httpStatusText(status), m.Name)
+	case "Error":
+		status = "http.StatusInternalServerError"
+		doc = fmt.Sprintf("// %s checks %s answers %s when %s fails.\n", testName, route, httpStatusText(status), m.Name)
+		errDecl = fmt.Sprintf("\twantErr := errors.New(\"%s failed\")\n", m.Name)
+	}
+
+	test := fmt.Sprintf("%sfunc %s(t *testing.T) {\n", doc, testName)
+	test = fmt.Sprintf("%s\tsvc := &%s{}\n", test, mockNameFor(svc))
+	if failure != "BadJSON" {
+		results := []string{}
+		for idx, r := range m.Returns {
+			if idx == len(m.Returns)-1 {
+				results = append(results, "wantErr")
+				continue
+			}
+			test = fmt.Sprintf("%s\t%s\n", test, sampleDecl(r, fmt.Sprintf("want%d", idx)))
+			results = append(results, fmt.Sprintf("want%d", idx))
+		}
+		test = fmt.Sprintf("%s%s\tsvc.%sReturns(%s)\n", test, errDecl, m.Name, strings.Join(results, ", "))
+	}
+
+	body := "nil"
+	if hd.Parses {
+		body = "strings.NewReader(\"{}\")"
+		if failure == "BadJSON" {
+			body = "strings.NewReader(\"{\")"
+		}
+	}
+	test = fmt.Sprintf("%s\treq := httptest.NewRequest(http.Method%s, APIV1+\"%s\", %s)\n\n", test, hd.Method, samplePath(hd.Path), body)
+	test = fmt.Sprintf("%s\tw := serve%s(svc, req)\n", test, c.Name)
+	test = fmt.Sprintf("%s\tassert.Equal(t, %s, w.Code)\n", test, status)
+	if failure == "BadJSON" {
+		return fmt.Sprintf("%s\tsvc.Assert%sCalled(t, 0)\n}\n", test, m.Name)
+	}
+
+	test = fmt.Sprintf("%s\tsvc.Assert%sCalled(t, 1)\n", test, m.Name)
+	params := nonContextParams(m)
+	for idx := range pathParamNames(hd.Path) {
+		want := fmt.Sprintf("\"%s\"", pathParamSample)
+		if params[idx].Type != "string" {
+			want = fmt.Sprintf("%s(%s)", params[idx].Type, pathParamSample)
+		}
+		test = fmt.Sprintf("%s\tassert.Equal(t, %s, svc.%sCalls()[0].%s)\n", test, want, m.Name, callFieldName(params[idx]))
+	}
+	return fmt.Sprintf("%s}\n", test)
+}
+
+// pathParamNames are the params of a path i.e. org_id for /org/:org_id/%route%
+func pathParamNames(path string) []string {
+	names := []string{}
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, ":") {
+			names = append(names, segment[1:])
+		}
+	}
+	return names
+}
+
+// samplePath fills the params of path with pathParamSample.
+func samplePath(path string) string {
+	for _, name := range pathParamNames(path) {
+		path = strings.Replace(path, ":"+name, pathParamSample, 1)
+	}
+	return path
+}
+
+// httpStatusText is how the docs of the tests name a status i.e. 404 Not Found for
+// http.StatusNotFound
+func httpStatusText(status string) string {
+	texts := map[string]string{
+		"http.StatusOK":                  "200 OK",
+		"http.StatusCreated":             "201 Created",
+		"http.StatusNoContent":           "204 No Content",
+		"http.StatusBadRequest":          "400 Bad Request",
+		"http.StatusNotFound":            "404 Not Found",
+		"http.StatusInternalServerError": "500 Internal Server Error",
+	}
+	return texts[status]
+}
+
+func lowerFirst(name string) string {
+	runes := []rune(name)
+	runes[0] = unicode.ToLower(runes[0])
+	return string(runes)
+}
+
+const renderTestTemplate = `// testView answers with v as JSON, for the tests of the controllers.
+type testView struct{}
+
+func (testView) JSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// testParser parses the JSON body of the request into v, for the tests of the controllers.
+type testParser struct{}
+
+func (testParser) Parse(r *http.Request, v interface{}) error {
+	return json.NewDecoder(r.Body).Decode(v)
+}
+`
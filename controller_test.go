@@ -0,0 +1,200 @@
+package main
+
+import (
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes the files, keyed by their path under root.
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, src := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// useGOPATH makes gopath where rawdog and the type checker find packages, for the test.
+func useGOPATH(t *testing.T, gopath string) {
+	t.Helper()
+	t.Setenv("GO111MODULE", "off")
+	t.Setenv("GOPATH", gopath)
+	defaultContext := build.Default
+	build.Default.GOPATH = gopath
+	t.Cleanup(func() { build.Default = defaultContext })
+}
+
+// typeCheckDir type checks the package in dir, tests included.
+func typeCheckDir(t *testing.T, dir string) {
+	t.Helper()
+
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pkg := range pkgs {
+		files := []*ast.File{}
+		for _, f := range pkg.Files {
+			files = append(files, f)
+		}
+		conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+		if _, err := conf.Check(pkg.Name, fset, files, nil); err != nil {
+			t.Fatalf("%s doesn't type check: %v", dir, err)
+		}
+	}
+}
+
+// fixtureFiles are the packages around the controllers of the app layout rawdog scaffolds for.
+var fixtureFiles = map[string]string{
+	"src/domain/account.go": `package domain
+
+import "net/http"
+
+type Account struct {
+	ID   int
+	Name string
+}
+
+type IViewAdapter interface {
+	JSON(w http.ResponseWriter, status int, v interface{})
+}
+
+type IViewParser interface {
+	Parse(r *http.Request, v interface{}) error
+}
+`,
+	"src/lib/router/router.go": `package router
+
+import "net/http"
+
+func Get(path string, h http.HandlerFunc)       {}
+func Put(path string, h http.HandlerFunc)       {}
+func Delete(path string, h http.HandlerFunc)    {}
+func Param(r *http.Request, name string) string { return "" }
+func Instance() http.Handler                    { return http.NotFoundHandler() }
+`,
+	"src/github.com/stretchr/testify/assert/assert.go": `package assert
+
+func Equal(t interface{}, expected interface{}, actual interface{}, msgAndArgs ...interface{}) bool {
+	return true
+}
+`,
+	"src/app/webapi/adapter/controller/api.go": `package controller
+
+const APIV1 = "/v1"
+`,
+}
+
+// TestMakeControllerIntIDErrorOnly checks the controller of a service with int ids, whose
+// Update and DeleteByID only return an error, compiles. The conversion of the id and the
+// service call both have an error to declare.
+func TestMakeControllerIntIDErrorOnly(t *testing.T) {
+	gopath := t.TempDir()
+	useGOPATH(t, gopath)
+	writeFiles(t, gopath, fixtureFiles)
+	writeFiles(t, gopath, map[string]string{
+		"src/app/webapi/logic/account_service.go": `package logic
+
+import (
+	"context"
+
+	"domain"
+)
+
+type IAccountService interface {
+	ByID(ctx context.Context, id int) (*domain.Account, error)
+	Update(ctx context.Context, id int, item *domain.Account) error
+	DeleteByID(ctx context.Context, id int) error
+}
+`,
+	})
+
+	outdir := filepath.Join(gopath, "src/app/webapi/adapter/controller")
+	serviceFile := filepath.Join(gopath, "src/app/webapi/logic/account_service.go")
+	if err := makeController("Account", outdir, serviceFile, "lib"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctrl, err := os.ReadFile(filepath.Join(outdir, "account.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(ctrl), "err := h.Account.DeleteByID(r.Context(), id)") {
+		t.Errorf("Destroy doesn't call DeleteByID with the id:\n%s", ctrl)
+	}
+	typeCheckDir(t, outdir)
+}
+
+// TestMakeControllerSizedIntIDs checks the ids of the routes are parsed into the integer
+// types the service takes, not only int.
+func TestMakeControllerSizedIntIDs(t *testing.T) {
+	gopath := t.TempDir()
+	useGOPATH(t, gopath)
+	writeFiles(t, gopath, fixtureFiles)
+	writeFiles(t, gopath, map[string]string{
+		"src/app/webapi/logic/account_service.go": `package logic
+
+import (
+	"context"
+
+	"domain"
+)
+
+type IAccountService interface {
+	ByID(ctx context.Context, id int64) (*domain.Account, error)
+	Update(ctx context.Context, id uint32, item *domain.Account) error
+	DeleteByID(ctx context.Context, id int16) error
+}
+`,
+	})
+
+	outdir := filepath.Join(gopath, "src/app/webapi/adapter/controller")
+	serviceFile := filepath.Join(gopath, "src/app/webapi/logic/account_service.go")
+	if err := makeController("Account", outdir, serviceFile, "lib"); err != nil {
+		t.Fatal(err)
+	}
+	typeCheckDir(t, outdir)
+}
+
+// TestMakeControllerUnsupportedID checks an id the controller can't read from the path fails
+// the generation rather than the build of the controller.
+func TestMakeControllerUnsupportedID(t *testing.T) {
+	gopath := t.TempDir()
+	useGOPATH(t, gopath)
+	writeFiles(t, gopath, fixtureFiles)
+	writeFiles(t, gopath, map[string]string{
+		"src/app/webapi/logic/account_service.go": `package logic
+
+import (
+	"context"
+
+	"domain"
+)
+
+type IAccountService interface {
+	ByID(ctx context.Context, id float64) (*domain.Account, error)
+}
+`,
+	})
+
+	outdir := filepath.Join(gopath, "src/app/webapi/adapter/controller")
+	serviceFile := filepath.Join(gopath, "src/app/webapi/logic/account_service.go")
+	err := makeController("Account", outdir, serviceFile, "lib")
+	if err == nil || !strings.Contains(err.Error(), "float64") {
+		t.Fatalf("want an error for the float64 id, got %v", err)
+	}
+}
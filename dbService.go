@@ -5,20 +5,20 @@ import (
 	"go/ast"
 	"go/parser"
 	"go/token"
-	"os"
 	"path"
 	"strings"
 )
 
-func makeDBService(modelFile string, serviceFile string) {
+// makeDBService writes the queries for the model in modelFile. withContext makes every query
+// take a context first and hand it to the database.
+func makeDBService(modelFile string, serviceFile string, withContext bool) error {
 	input := modelFile
 	output := serviceFile
 
 	fset := token.NewFileSet()                      // positions are relative to fset
 	f, err := parser.ParseFile(fset, input, nil, 0) //parser.Trace
 	if err != nil {
-		fmt.Println(err)
-		return
+		return err
 	}
 
 	//ast.Print(fset, f)
@@ -75,36 +75,81 @@ func makeDBService(modelFile string, serviceFile string) {
 
 	tableName := path.Base(modelFile)
 	tableName = tableName[0 : len(tableName)-3]
-	getAll := AllQuery(domainType, tableName)
-	byID := ByIDQuery(domainType, tableName)
+	getAll := AllQuery(domainType, tableName, withContext)
+	byID := ByIDQuery(domainType, tableName, withContext)
 	var allAugmented string
 	var byIDAugmented string
 	var byForeignKey string
 	var byForeignKeyAugmented string
 	if hasAugmented {
-		allAugmented = AllAugmentedQuery(domainType, tableName, dbCols)
-		byIDAugmented = ByIDAugmentedQuery(domainType, tableName, dbCols)
-		byForeignKey = ByForeignKeyQueries(domainType, tableName, dbCols, varNames)
-		byForeignKeyAugmented = ByForeignKeyAugmentedQueries(domainType, tableName, dbCols, varNames)
+		allAugmented = AllAugmentedQuery(domainType, tableName, dbCols, withContext)
+		byIDAugmented = ByIDAugmentedQuery(domainType, tableName, dbCols, withContext)
+		byForeignKey = ByForeignKeyQueries(domainType, tableName, dbCols, varNames, withContext)
+		byForeignKeyAugmented = ByForeignKeyAugmentedQueries(domainType, tableName, dbCols, varNames, withContext)
 	}
-	store := StoreQuery(domainType, tableName, dbCols, varNames)
-	deleteByID := DeleteByIDQuery(domainType, tableName)
+	store := StoreQuery(domainType, tableName, dbCols, varNames, withContext)
+	update := UpdateQuery(domainType, tableName, dbCols, varNames, withContext)
+	patch := PatchQuery(domainType, tableName, dbCols, varNames, withContext)
+	deleteByID := DeleteByIDQuery(domainType, tableName, withContext)
+
+	serviceOut := fmt.Sprintf("// Generated by Rawdog\n\npackage %s\n\n%v\n\n%v\n\n%v%v%v%v%v\n\n%v\n\n%v\n\n%v", f.Name.Name, getAll, byID, allAugmented, byIDAugmented, byForeignKey, byForeignKeyAugmented, store, update, patch, deleteByID)
+
+	imports := newImportSet()
+	imports.addFile(f)
+	imports.addAll(appImports)
+	if err := writeSupportFile(output, f.Name.Name, queryErrorsFile, queryErrorsTemplate, newImportSet()); err != nil {
+		return err
+	}
+	return writeGoFile(output, serviceOut, imports)
+}
 
-	serviceOut := fmt.Sprintf("// The following text should be inserted after toEntity[Augmented] \n\n%v\n\n%v\n\n%v%v%v%v%v\n\n%v", getAll, byID, allAugmented, byIDAugmented, byForeignKey, byForeignKeyAugmented, store, deleteByID)
+// queryErrorsFile is where the errors the queries of every model return are written, next to them.
+const queryErrorsFile = "generatedErrors.go"
 
-	file, err := os.Create(output)
-	if err != nil {
-		fmt.Printf("ERROR: %v\n", err)
-		return
+const queryErrorsTemplate = `// UnknownFieldError is returned by Patch for a field the record doesn't have.
+type UnknownFieldError struct {
+	Field string
+}
+
+func (e UnknownFieldError) Error() string {
+	return fmt.Sprintf("unknown field %q", e.Field)
+}
+
+// Invalid tells the controllers the error is the fault of the input, answered with 400 Bad Request.
+func (e UnknownFieldError) Invalid() bool {
+	return true
+}
+`
+
+// queryParams declares the params of a generated query, after a context when withContext is set.
+func queryParams(withContext bool, params ...string) string {
+	if withContext {
+		params = append([]string{"ctx context.Context"}, params...)
+	}
+	return strings.Join(params, ", ")
+}
+
+// queryArgs passes the arguments to a generated query, after the context when withContext is set.
+func queryArgs(withContext bool, args ...string) string {
+	if withContext {
+		args = append([]string{"ctx"}, args...)
 	}
-	defer file.Close()
+	return strings.Join(args, ", ")
+}
 
-	file.WriteString(serviceOut)
+// dbCall opens a call to a method of the connection, passing the context along when withContext
+// is set i.e. SelectContext(ctx,
+func dbCall(method string, withContext bool) string {
+	if withContext {
+		return method + "Context(ctx, "
+	}
+	return method + "("
 }
-func AllQuery(serviceName, tableName string) string {
+
+func AllQuery(serviceName, tableName string, withContext bool) string {
 	allQueryBlock := fmt.Sprintf("// All will retrieve all %s records in the database.", serviceName)
-	methodStr := fmt.Sprintf("func (s *%sService) All() ([]domain.%s, error) {", serviceName, serviceName)
-	methodContents := fmt.Sprintf("\tdb%sRecords := []%s{}\n\terr := s.db.Connection().Select(&db%sRecords, `", serviceName, serviceName, serviceName)
+	methodStr := fmt.Sprintf("func (s *%sService) All(%s) ([]domain.%s, error) {", serviceName, queryParams(withContext), serviceName)
+	methodContents := fmt.Sprintf("\tdb%sRecords := []%s{}\n\terr := s.db.Connection().%s&db%sRecords, `", serviceName, serviceName, dbCall("Select", withContext), serviceName)
 	sqlQuery := fmt.Sprintf(`
 		Select %s.*
 		FROM %s
@@ -116,10 +161,10 @@ func AllQuery(serviceName, tableName string) string {
 	return allQueryBlock
 }
 
-func ByIDQuery(serviceName, tableName string) string {
+func ByIDQuery(serviceName, tableName string, withContext bool) string {
 	allQueryBlock := fmt.Sprintf("// ByID will retrieve the %s record with the input ID.", serviceName)
-	methodStr := fmt.Sprintf("func (s *%sService) ByID(id string) (*domain.%s, error) {", serviceName, serviceName)
-	methodContents := fmt.Sprintf("\tresult := %s{}\n\terr := s.db.Connection().Get(&result, `", serviceName)
+	methodStr := fmt.Sprintf("func (s *%sService) ByID(%s) (*domain.%s, error) {", serviceName, queryParams(withContext, "id string"), serviceName)
+	methodContents := fmt.Sprintf("\tresult := %s{}\n\terr := s.db.Connection().%s&result, `", serviceName, dbCall("Get", withContext))
 	sqlQuery := fmt.Sprintf(`
 		Select %s.*
 		FROM %s
@@ -132,10 +177,10 @@ func ByIDQuery(serviceName, tableName string) string {
 	return allQueryBlock
 }
 
-func AllAugmentedQuery(serviceName, tableName string, dbCols []string) string {
+func AllAugmentedQuery(serviceName, tableName string, dbCols []string, withContext bool) string {
 	allQueryBlock := fmt.Sprintf("// AllAugmented will retrieve all %sAugmented records in the database.", serviceName)
-	methodStr := fmt.Sprintf("func (s *%sService) AllAugmented() ([]domain.%sAugmented, error) {", serviceName, serviceName)
-	methodContents := fmt.Sprintf("\tdb%sRecords := []%sAugmented{}\n\terr := s.db.Connection().Select(&db%sRecords, `", serviceName, serviceName, serviceName)
+	methodStr := fmt.Sprintf("func (s *%sService) AllAugmented(%s) ([]domain.%sAugmented, error) {", serviceName, queryParams(withContext), serviceName)
+	methodContents := fmt.Sprintf("\tdb%sRecords := []%sAugmented{}\n\terr := s.db.Connection().%s&db%sRecords, `", serviceName, serviceName, dbCall("Select", withContext), serviceName)
 	var additionalTableStr string
 	var joinStr string
 	for _, dbCol := range dbCols {
@@ -160,10 +205,10 @@ func AllAugmentedQuery(serviceName, tableName string, dbCols []string) string {
 	return allQueryBlock
 }
 
-func ByIDAugmentedQuery(serviceName, tableName string, dbCols []string) string {
+func ByIDAugmentedQuery(serviceName, tableName string, dbCols []string, withContext bool) string {
 	allQueryBlock := fmt.Sprintf("// ByIDAugmented will retrieve the %sAugmented record with the input ID.", serviceName)
-	methodStr := fmt.Sprintf("func (s *%sService) ByIDAugmented(id string) (*domain.%sAugmented, error) {", serviceName, serviceName)
-	methodContents := fmt.Sprintf("\tresult := %sAugmented{}\n\terr := s.db.Connection().Get(&result, `", serviceName)
+	methodStr := fmt.Sprintf("func (s *%sService) ByIDAugmented(%s) (*domain.%sAugmented, error) {", serviceName, queryParams(withContext, "id string"), serviceName)
+	methodContents := fmt.Sprintf("\tresult := %sAugmented{}\n\terr := s.db.Connection().%s&result, `", serviceName, dbCall("Get", withContext))
 	var additionalTableStr string
 	var joinStr string
 	for _, dbCol := range dbCols {
@@ -189,7 +234,7 @@ func ByIDAugmentedQuery(serviceName, tableName string, dbCols []string) string {
 	return allQueryBlock
 }
 
-func ByForeignKeyQueries(serviceName, tableName string, dbCols, varNames []string) string {
+func ByForeignKeyQueries(serviceName, tableName string, dbCols, varNames []string, withContext bool) string {
 	var foreignKeyList []string
 	var foreignKeyVarList []string
 	var byForeignKeyQueriesStr string
@@ -205,8 +250,8 @@ func ByForeignKeyQueries(serviceName, tableName string, dbCols, varNames []strin
 
 	for i, foreignKey := range foreignKeyList {
 		allQueryBlock := fmt.Sprintf("// By%s will retrieve all %s records in the database with a given %s.", foreignKeyVarList[i], serviceName, foreignKey)
-		methodStr := fmt.Sprintf("func (s *%sService) By%s(%s string) ([]domain.%s, error) {", serviceName, foreignKeyVarList[i], foreignKey, serviceName)
-		methodContents := fmt.Sprintf("\tdb%sRecords := []%s{}\n\terr := s.db.Connection().Select(&db%sRecords, `", serviceName, serviceName, serviceName)
+		methodStr := fmt.Sprintf("func (s *%sService) By%s(%s) ([]domain.%s, error) {", serviceName, foreignKeyVarList[i], queryParams(withContext, foreignKey+" string"), serviceName)
+		methodContents := fmt.Sprintf("\tdb%sRecords := []%s{}\n\terr := s.db.Connection().%s&db%sRecords, `", serviceName, serviceName, dbCall("Select", withContext), serviceName)
 		sqlQuery := fmt.Sprintf(`
 		Select %s.*
 		FROM %s
@@ -222,7 +267,7 @@ func ByForeignKeyQueries(serviceName, tableName string, dbCols, varNames []strin
 	return byForeignKeyQueriesStr
 }
 
-func ByForeignKeyAugmentedQueries(serviceName, tableName string, dbCols, varNames []string) string {
+func ByForeignKeyAugmentedQueries(serviceName, tableName string, dbCols, varNames []string, withContext bool) string {
 	var foreignKeyList []string
 	var foreignKeyVarList []string
 	var byForeignKeyAugmentedQueriesStr string
@@ -247,9 +292,9 @@ func ByForeignKeyAugmentedQueries(serviceName, tableName string, dbCols, varName
 
 	for i, foreignKey := range foreignKeyList {
 		allQueryBlock := fmt.Sprintf("// By%sAugmented will retrieve all %s records in the database with a given %s.", foreignKeyVarList[i], serviceName, foreignKey)
-		methodStr := fmt.Sprintf("func (s *%sService) By%sAugmented(%s string) ([]domain.%sAugmented, error) {", serviceName, foreignKeyVarList[i], foreignKey, serviceName)
+		methodStr := fmt.Sprintf("func (s *%sService) By%sAugmented(%s) ([]domain.%sAugmented, error) {", serviceName, foreignKeyVarList[i], queryParams(withContext, foreignKey+" string"), serviceName)
 
-		methodContents := fmt.Sprintf("\tdb%sRecords := []%sAugmented{}\n\terr := s.db.Connection().Select(&db%sRecords, `", serviceName, serviceName, serviceName)
+		methodContents := fmt.Sprintf("\tdb%sRecords := []%sAugmented{}\n\terr := s.db.Connection().%s&db%sRecords, `", serviceName, serviceName, dbCall("Select", withContext), serviceName)
 		sqlQuery := fmt.Sprintf(`
 		Select %s.*%s
 		FROM %s%s
@@ -265,10 +310,11 @@ func ByForeignKeyAugmentedQueries(serviceName, tableName string, dbCols, varName
 	return byForeignKeyAugmentedQueriesStr
 }
 
-func StoreQuery(serviceName, tableName string, dbCols, varNames []string) string {
-	allQueryBlock := fmt.Sprintf("// Store will store a %s record in the database.", serviceName)
-	methodStr := fmt.Sprintf("func (s *%sService) Store(item *domain.%s) (*domain.%s, error) {", serviceName, serviceName, serviceName)
-	methodContents := fmt.Sprint("\tres, err := s.db.Connection().Exec(`")
+func StoreQuery(serviceName, tableName string, dbCols, varNames []string, withContext bool) string {
+	// inserts aren't safe to repeat, so retrying decorators leave Store alone
+	allQueryBlock := fmt.Sprintf("// Store will store a %s record in the database.\n//%s", serviceName, noRetryDirective)
+	methodStr := fmt.Sprintf("func (s *%sService) Store(%s) (*domain.%s, error) {", serviceName, queryParams(withContext, "item *domain."+serviceName), serviceName)
+	methodContents := fmt.Sprintf("\tres, err := s.db.Connection().%s`", dbCall("Exec", withContext))
 	fieldList := ""
 	qList := ""
 	vList := ""
@@ -312,10 +358,96 @@ func StoreQuery(serviceName, tableName string, dbCols, varNames []string) string
 	return allQueryBlock
 }
 
-func DeleteByIDQuery(serviceName, tableName string) string {
+func UpdateQuery(serviceName, tableName string, dbCols, varNames []string, withContext bool) string {
+	updateQueryBlock := fmt.Sprintf("// Update will replace the fields of the %s record with the input ID.", serviceName)
+	methodStr := fmt.Sprintf("func (s *%sService) Update(%s) (*domain.%s, error) {", serviceName, queryParams(withContext, "id string", "item *domain."+serviceName), serviceName)
+	methodContents := fmt.Sprintf("\t_, err := s.db.Connection().%s`", dbCall("Exec", withContext))
+	setList := ""
+	vList := ""
+	for i, dbCol := range dbCols {
+		if varNames[i] != "ID" {
+			if len(setList) == 0 {
+				setList = dbCol[len(tableName)+1:] + " = ?"
+				vList = "item." + varNames[i]
+			} else {
+				setList = setList + ", " + dbCol[len(tableName)+1:] + " = ?"
+				vList = vList + ", item." + varNames[i]
+			}
+		}
+	}
+
+	sqlQuery := fmt.Sprintf(`
+		UPDATE %s
+		SET %s
+		WHERE id = ?
+			AND deleted_at IS NULL
+		LIMIT 1
+		`, tableName, setList)
+
+	// read it back, which also tells a record that doesn't exist from one that didn't change
+	handleReturnStr := fmt.Sprintf(`
+	if err != nil {
+		return nil, err
+	}
+
+	return s.ByID(%s)`, queryArgs(withContext, "id"))
+
+	updateQueryBlock = fmt.Sprintf("%s\n%s\n%s%s`, %s, id)\n%s\n}", updateQueryBlock, methodStr, methodContents, sqlQuery, vList, handleReturnStr)
+	return updateQueryBlock
+}
+
+func PatchQuery(serviceName, tableName string, dbCols, varNames []string, withContext bool) string {
+	patchQueryBlock := fmt.Sprintf("// Patch will set the given fields of the %s record with the input ID, leaving the others as\n// they are. Fields are named as in domain.%s.", serviceName, serviceName)
+	methodStr := fmt.Sprintf("func (s *%sService) Patch(%s) (*domain.%s, error) {", serviceName, queryParams(withContext, "id string", "fields map[string]interface{}"), serviceName)
+
+	columnList := ""
+	for i, dbCol := range dbCols {
+		if varNames[i] != "ID" {
+			columnList = fmt.Sprintf("%s\t\t\"%s\": \"%s\",\n", columnList, varNames[i], dbCol[len(tableName)+1:])
+		}
+	}
+	methodContents := fmt.Sprintf(`	columns := map[string]string{
+%s	}
+	set := []string{}
+	args := []interface{}{}
+	for field, value := range fields {
+		column, ok := columns[field]
+		if !ok {
+			return nil, UnknownFieldError{Field: field}
+		}
+		set = append(set, column+" = ?")
+		args = append(args, value)
+	}
+	if len(set) == 0 {
+		return s.ByID(%s)
+	}
+	args = append(args, id)
+
+	_, err := s.db.Connection().%s`+"`", columnList, queryArgs(withContext, "id"), dbCall("Exec", withContext))
+
+	sqlQuery := fmt.Sprintf(`
+		UPDATE %s
+		SET `+"`"+`+strings.Join(set, ", ")+`+"`"+`
+		WHERE id = ?
+			AND deleted_at IS NULL
+		LIMIT 1
+		`, tableName)
+
+	handleReturnStr := fmt.Sprintf(`
+	if err != nil {
+		return nil, err
+	}
+
+	return s.ByID(%s)`, queryArgs(withContext, "id"))
+
+	patchQueryBlock = fmt.Sprintf("%s\n%s\n%s%s`, args...)\n%s\n}", patchQueryBlock, methodStr, methodContents, sqlQuery, handleReturnStr)
+	return patchQueryBlock
+}
+
+func DeleteByIDQuery(serviceName, tableName string, withContext bool) string {
 	deleteQueryBlock := fmt.Sprintf("// DeleteByID mark the %s record with the specified ID as deleted.", serviceName)
-	methodStr := fmt.Sprintf("func (s *%sService) DeleteByID(id string) (error) {", serviceName)
-	methodContents := fmt.Sprint("\t_, err := s.db.Connection().Exec(`")
+	methodStr := fmt.Sprintf("func (s *%sService) DeleteByID(%s) (error) {", serviceName, queryParams(withContext, "id string"))
+	methodContents := fmt.Sprintf("\t_, err := s.db.Connection().%s`", dbCall("Exec", withContext))
 	sqlQuery := fmt.Sprintf(`
 		UPDATE %s
 		SET deleted_at = NOW()
@@ -5,20 +5,21 @@ import (
 	"go/ast"
 	"go/parser"
 	"go/token"
-	"os"
 	"path"
+	"path/filepath"
 	"strings"
 )
 
-func makeDBTests(modelFile string, serviceFile string) {
+// makeDBTests writes the tests of the queries for the model in modelFile. withContext calls the
+// queries with a context, as generated by makeDBService with withContext.
+func makeDBTests(modelFile string, serviceFile string, withContext bool) error {
 	input := modelFile
 	output := serviceFile
 
 	fset := token.NewFileSet()                      // positions are relative to fset
 	f, err := parser.ParseFile(fset, input, nil, 0) //parser.Trace
 	if err != nil {
-		fmt.Println(err)
-		return
+		return err
 	}
 
 	//ast.Print(fset, f)
@@ -77,90 +78,84 @@ func makeDBTests(modelFile string, serviceFile string) {
 
 	tableName := path.Base(modelFile)
 	tableName = tableName[0 : len(tableName)-3]
-	getAll := AllTest(domainType, tableName)
-	byID := ByIDTest(domainType, tableName, varNames)
+	getAll := AllTest(domainType, tableName, withContext)
+	byID := ByIDTest(domainType, tableName, varNames, withContext)
 	var allAugmented string
 	var byIDAugmented string
 	var byForeignKey string
 	var byForeignKeyAugmented string
 
 	if hasAugmented {
-		allAugmented = AllAugmentedTest(domainType, tableName)
-		byIDAugmented = ByIDAugmentedTest(domainType, tableName, varNames)
-		byForeignKey = ByForeignKeyTests(domainType, tableName, dbCols, varNames)
-		byForeignKeyAugmented = ByForeignKeyAugmentedTests(domainType, tableName, dbCols, varNames)
+		allAugmented = AllAugmentedTest(domainType, tableName, withContext)
+		byIDAugmented = ByIDAugmentedTest(domainType, tableName, varNames, withContext)
+		byForeignKey = ByForeignKeyTests(domainType, tableName, dbCols, varNames, withContext)
+		byForeignKeyAugmented = ByForeignKeyAugmentedTests(domainType, tableName, dbCols, varNames, withContext)
 	}
 
-	store := StoreTest(domainType, tableName, varNames, varTypes)
-	deleteByID := DeleteByIDTest(domainType, tableName)
+	store := StoreTest(domainType, tableName, varNames, varTypes, withContext)
+	update := UpdateTest(domainType, tableName, dbCols, varNames, varTypes, withContext)
+	patch := PatchTest(domainType, tableName, dbCols, varNames, varTypes, withContext)
+	deleteByID := DeleteByIDTest(domainType, tableName, withContext)
 
 	fileHeader := fmt.Sprintf(`package mysqlrepo_test
 
-import (
-	"fmt"
-	"testing"
-
-	"adapter/mysqlrepo"
-	"domain"
-
-	"github.com/stretchr/testify/assert"
-)
-
 // Test%sRepo tests the account repo.
 func Test%sRepo(t *testing.T) {
 	s := mysqlrepo.New%sRepo(sharedDB)`, serviceName, serviceName, serviceName)
+	if withContext {
+		fileHeader = fmt.Sprintf("%s\n\tctx := context.Background()", fileHeader)
+	}
 
-	serviceOut := fmt.Sprintf("%v\n\n%v\n\n%v\n\n%v%v%v%v%v\n\n%v\n}", fileHeader, getAll, byID, allAugmented, byIDAugmented, byForeignKey, byForeignKeyAugmented, store, deleteByID)
+	serviceOut := fmt.Sprintf("%v\n\n%v\n\n%v\n\n%v%v%v%v%v\n\n%v\n\n%v\n\n%v\n}", fileHeader, getAll, byID, allAugmented, byIDAugmented, byForeignKey, byForeignKeyAugmented, store, update, patch, deleteByID)
 
-	file, err := os.Create(output)
-	if err != nil {
-		fmt.Printf("ERROR: %v\n", err)
-		return
+	imports := newImportSet()
+	imports.addFile(f)
+	if importPath, success := dirImportPath(filepath.Dir(modelFile)); success {
+		imports.add(f.Name.Name, importPath)
 	}
-	defer file.Close()
-
-	file.WriteString(serviceOut)
+	imports.addAll(appImports)
+	return writeGoFile(output, serviceOut, imports)
 }
 
-func AllTest(serviceName, tableName string) string {
+func AllTest(serviceName, tableName string, withContext bool) string {
 	allTestBlock := fmt.Sprintf("\t// Get all %s records in the database.", serviceName)
 	allTestBlock = fmt.Sprintf(`%s
-	all%s, err := s.All()
+	all%s, err := s.All(%s)
 	assert.Equal(t, err, nil)
-		`, allTestBlock, serviceName)
+		`, allTestBlock, serviceName, queryArgs(withContext))
 	return allTestBlock
 }
 
-func ByIDTest(serviceName, tableName string, varNames []string) string {
+func ByIDTest(serviceName, tableName string, varNames []string, withContext bool) string {
 	byIDTestBlock := fmt.Sprintf("\t// Get first %s record by ID.", serviceName)
 	byIDTestBlock = fmt.Sprintf(`%s
-	item0, err := s.ByID(fmt.Sprint(all%s[0].ID))
+	item0, err := s.ByID(%s)
 	assert.Equal(t, err, nil)
 	assert.Equal(t, all%s[0].%s, item0.%s)
-		`, byIDTestBlock, serviceName, serviceName, varNames[1], varNames[1])
+		`, byIDTestBlock, queryArgs(withContext, fmt.Sprintf("fmt.Sprint(all%s[0].ID)", serviceName)), serviceName, varNames[1], varNames[1])
 	return byIDTestBlock
 }
 
-func AllAugmentedTest(serviceName, tableName string) string {
+func AllAugmentedTest(serviceName, tableName string, withContext bool) string {
 	allAugmentedTestBlock := fmt.Sprintf("\t// Get all augmented %s records in the database.", serviceName)
 	allAugmentedTestBlock = fmt.Sprintf(`%s
-	all%sAugmented, err := s.AllAugmented()
+	all%sAugmented, err := s.AllAugmented(%s)
 	assert.Equal(t, err, nil)
-		`, allAugmentedTestBlock, serviceName)
+		`, allAugmentedTestBlock, serviceName, queryArgs(withContext))
 	return allAugmentedTestBlock
 }
 
-func ByIDAugmentedTest(serviceName, tableName string, varNames []string) string {
+func ByIDAugmentedTest(serviceName, tableName string, varNames []string, withContext bool) string {
 	byIDAugmentedTestBlock := fmt.Sprintf("\n\t// Get first augmented %s record by ID.", serviceName)
 	byIDAugmentedTestBlock = fmt.Sprintf(`%s
-	augItem0, err := s.ByIDAugmented(fmt.Sprint(all%sAugmented[0].ID))
+	augItem0, err := s.ByIDAugmented(%s)
 	assert.Equal(t, err, nil)
 	assert.Equal(t, all%sAugmented[0].%s, augItem0.%s)
-		`, byIDAugmentedTestBlock, serviceName, serviceName, varNames[1], varNames[1])
+		`, byIDAugmentedTestBlock, queryArgs(withContext, fmt.Sprintf("fmt.Sprint(all%sAugmented[0].ID)", serviceName)), serviceName, varNames[1], varNames[1])
 	return byIDAugmentedTestBlock
 }
 
-func ByForeignKeyTests(serviceName, tableName string, dbCols, varNames []string) string {
+func ByForeignKeyTests(serviceName, tableName string, dbCols, varNames []string, withContext bool) string {
 	var byForeignKeyTestsBlock string
 	//var foreignKeyList []string
 	var foreignKeyVarList []string
@@ -174,16 +169,16 @@ func ByForeignKeyTests(serviceName, tableName string, dbCols, varNames []string)
 		byForeignKeyTestsBlock = fmt.Sprintf("%s\n\n\t// Get %s record by %s.", byForeignKeyTestsBlock, serviceName, foreignKeyVar)
 
 		byForeignKeyTestsBlock = fmt.Sprintf(`%s
-	itemsBy%s, err := s.By%s(fmt.Sprint(all%s[0].%s))
+	itemsBy%s, err := s.By%s(%s)
 	assert.Equal(t, err, nil)
 	assert.Equal(t, all%s[0].%s, itemsBy%s[0].%s)
-		`, byForeignKeyTestsBlock, foreignKeyVar, foreignKeyVar, serviceName, foreignKeyVar, serviceName, foreignKeyVar, foreignKeyVar, foreignKeyVar)
+		`, byForeignKeyTestsBlock, foreignKeyVar, foreignKeyVar, queryArgs(withContext, fmt.Sprintf("fmt.Sprint(all%s[0].%s)", serviceName, foreignKeyVar)), serviceName, foreignKeyVar, foreignKeyVar, foreignKeyVar)
 
 	}
 	return byForeignKeyTestsBlock
 }
 
-func ByForeignKeyAugmentedTests(serviceName, tableName string, dbCols, varNames []string) string {
+func ByForeignKeyAugmentedTests(serviceName, tableName string, dbCols, varNames []string, withContext bool) string {
 	var byForeignKeyAugmentedTestsBlock string
 	//var foreignKeyList []string
 	var foreignKeyVarList []string
@@ -197,16 +192,16 @@ func ByForeignKeyAugmentedTests(serviceName, tableName string, dbCols, varNames
 		byForeignKeyAugmentedTestsBlock = fmt.Sprintf("%s\n\n\t// Get augmented %s record by %s.", byForeignKeyAugmentedTestsBlock, serviceName, foreignKeyVar)
 
 		byForeignKeyAugmentedTestsBlock = fmt.Sprintf(`%s
-	augItemsBy%s, err := s.By%sAugmented(fmt.Sprint(all%sAugmented[0].%s))
+	augItemsBy%s, err := s.By%sAugmented(%s)
 	assert.Equal(t, err, nil)
 	assert.Equal(t, all%sAugmented[0].%s, augItemsBy%s[0].%s)
-		`, byForeignKeyAugmentedTestsBlock, foreignKeyVar, foreignKeyVar, serviceName, foreignKeyVar, serviceName, foreignKeyVar, foreignKeyVar, foreignKeyVar)
+		`, byForeignKeyAugmentedTestsBlock, foreignKeyVar, foreignKeyVar, queryArgs(withContext, fmt.Sprintf("fmt.Sprint(all%sAugmented[0].%s)", serviceName, foreignKeyVar)), serviceName, foreignKeyVar, foreignKeyVar, foreignKeyVar)
 
 	}
 	return byForeignKeyAugmentedTestsBlock
 }
 
-func StoreTest(serviceName, tableName string, varNames, varTypes []string) string {
+func StoreTest(serviceName, tableName string, varNames, varTypes []string, withContext bool) string {
 	byIDTestBlock := fmt.Sprintf("\n\t// Store a %s record.", serviceName)
 	var fieldVals string
 	for i, varName := range varNames {
@@ -236,16 +231,96 @@ func StoreTest(serviceName, tableName string, varNames, varTypes []string) strin
 	new%s, err := %sRepo.Store(%s)
 	assert.Equal(t, err, nil)
 	assert.Equal(t, new%s.%s, %s.%s)
-		`, byIDTestBlock, tableName, serviceName, tableName, serviceName, fieldVals, serviceName, tableName, tableName, serviceName, varNames[1], tableName, varNames[1])
+		`, byIDTestBlock, tableName, serviceName, tableName, serviceName, fieldVals, serviceName, tableName, queryArgs(withContext, tableName), serviceName, varNames[1], tableName, varNames[1])
 
 	return byIDTestBlock
 }
 
-func DeleteByIDTest(serviceName, tableName string) string {
+// changeableField picks the field the tests of Update and Patch change, a string if there's
+// one, that isn't the ID or a foreign key the database may check.
+func changeableField(dbCols, varNames, varTypes []string) int {
+	picked := -1
+	for i, varName := range varNames {
+		if varName == "ID" || strings.HasSuffix(dbCols[i], "_id") {
+			continue
+		}
+		if varTypes[i] != "string" && varTypes[i] != "int" && varTypes[i] != "float64" && varTypes[i] != "bool" {
+			continue
+		}
+		if varTypes[i] == "string" {
+			return i
+		}
+		if picked == -1 {
+			picked = i
+		}
+	}
+	return picked
+}
+
+// changedValue is a value of varType other than what StoreTest stores, the nth change of it.
+func changedValue(varType, varName string, n int) string {
+	switch varType {
+	case "int":
+		return fmt.Sprint(n + 1)
+	case "float64":
+		return fmt.Sprintf("%d000.0", n+1)
+	case "bool":
+		return fmt.Sprint(n%2 == 1)
+	}
+	return fmt.Sprintf(`"test%s%d"`, varName, n+1)
+}
+
+func UpdateTest(serviceName, tableName string, dbCols, varNames, varTypes []string, withContext bool) string {
+	updateTestBlock := fmt.Sprintf("\t// Update the stored %s record with a changed field and read it back.", serviceName)
+	field := changeableField(dbCols, varNames, varTypes)
+	if field == -1 {
+		updateTestBlock = fmt.Sprintf(`%s
+	_, err = s.Update(%s)
+	assert.Equal(t, err, nil)
+		`, updateTestBlock, queryArgs(withContext, fmt.Sprintf("fmt.Sprint(new%s.ID)", serviceName), tableName))
+		return updateTestBlock
+	}
+	value := changedValue(varTypes[field], varNames[field], 1)
+
+	updateTestBlock = fmt.Sprintf(`%s
+	%s.%s = %s
+	_, err = s.Update(%s)
+	assert.Equal(t, err, nil)
+	updated%s, err := s.ByID(%s)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, %s, updated%s.%s)
+		`, updateTestBlock, tableName, varNames[field], value, queryArgs(withContext, fmt.Sprintf("fmt.Sprint(new%s.ID)", serviceName), tableName), serviceName, queryArgs(withContext, fmt.Sprintf("fmt.Sprint(new%s.ID)", serviceName)), value, serviceName, varNames[field])
+	return updateTestBlock
+}
+
+func PatchTest(serviceName, tableName string, dbCols, varNames, varTypes []string, withContext bool) string {
+	patchTestBlock := fmt.Sprintf("\t// Patch a field of the stored %s record, the others keep their values.", serviceName)
+	field := changeableField(dbCols, varNames, varTypes)
+	if field == -1 {
+		return ""
+	}
+	value := changedValue(varTypes[field], varNames[field], 2)
+
+	patchTestBlock = fmt.Sprintf(`%s
+	_, err = s.Patch(%s)
+	assert.Equal(t, err, nil)
+	patched%s, err := s.ByID(%s)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, %s, patched%s.%s)`, patchTestBlock, queryArgs(withContext, fmt.Sprintf("fmt.Sprint(new%s.ID)", serviceName), fmt.Sprintf("map[string]interface{}{\"%s\": %s}", varNames[field], value)), serviceName, queryArgs(withContext, fmt.Sprintf("fmt.Sprint(new%s.ID)", serviceName)), value, serviceName, varNames[field])
+	for i, varName := range varNames {
+		if varName != "ID" && i != field {
+			patchTestBlock = fmt.Sprintf("%s\n\tassert.Equal(t, %s.%s, patched%s.%s)", patchTestBlock, tableName, varName, serviceName, varName)
+			break
+		}
+	}
+	return fmt.Sprintf("%s\n\t\t", patchTestBlock)
+}
+
+func DeleteByIDTest(serviceName, tableName string, withContext bool) string {
 	deleteByIDTestBlock := fmt.Sprintf("\t// Delete a %s record by its id.", serviceName)
 	deleteByIDTestBlock = fmt.Sprintf(`%s
-	err = s.DeleteByID(fmt.Sprint(new%s.ID))
+	err = s.DeleteByID(%s)
 	assert.Equal(t, err, nil)
-		`, deleteByIDTestBlock, serviceName)
+		`, deleteByIDTestBlock, queryArgs(withContext, fmt.Sprintf("fmt.Sprint(new%s.ID)", serviceName)))
 	return deleteByIDTestBlock
 }
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// makeDecorators writes a wrapper made by build for every interface in inFile, or only for
+// the interfaces named in selected.
+func makeDecorators(inFile string, outFile string, selected []string, outPackage string, build func(Interface) string) error {
+	interfaces, imports, outPackage, err := fileInterfaces(inFile, outFile, outPackage)
+	if err != nil {
+		return err
+	}
+
+	decorators := fmt.Sprintf("// Generated by Rawdog\n\npackage %s\n", outPackage)
+	for _, i := range interfaces {
+		if len(selected) > 0 && !isSelected(i.Name, selected) {
+			continue
+		}
+		decorators = fmt.Sprintf("%s\n\n%s", decorators, build(i))
+	}
+	for _, name := range selected {
+		if !hasInterface(interfaces, name) {
+			fmt.Printf("WARNING: %s has no interface %s\n", inFile, name)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outFile), 0755); err != nil {
+		return err
+	}
+	return writeGoFile(outFile, decorators, imports)
+}
+
+// writeSupportFile writes the code the decorators or controllers in outFile depend on to a file called name
+// in the same dir, once per package, leaving alone any file by that name rawdog didn't generate.
+// outPackage is found from the output dir unless it's given. imports names the packages
+// the template uses that aren't in the standard library.
+func writeSupportFile(outFile string, outPackage string, name string, template string, imports *importSet) error {
+	output := filepath.Join(filepath.Dir(outFile), name)
+	if mustAbs(output) == mustAbs(outFile) {
+		return fmt.Errorf("%s is where the support code goes, pick another output file", outFile)
+	}
+	if handWritten(output) {
+		fmt.Printf("WARNING: %s wasn't generated by rawdog, not overwriting it\n", output)
+		return nil
+	}
+
+	if outPackage == "" {
+		outPackage = outputPackage(output)
+	}
+	support := fmt.Sprintf("// Generated by Rawdog\n\npackage %s\n\n%s", outPackage, template)
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return err
+	}
+	return writeGoFile(output, support, imports)
+}
+
+// handWritten reports whether there's a file at path that rawdog didn't generate.
+func handWritten(path string) bool {
+	existing, err := os.ReadFile(path)
+	return err == nil && !strings.HasPrefix(string(existing), "// Generated by Rawdog")
+}
+
+func hasInterface(interfaces []Interface, name string) bool {
+	for _, i := range interfaces {
+		if i.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// decoratorName names the wrapper of an interface i.e. LoggingAccountService for IAccountService.
+func decoratorName(prefix string, i Interface) string {
+	runes := []rune(i.Name)
+	if len(runes) > 1 && runes[0] == 'I' && unicode.IsUpper(runes[1]) {
+		return prefix + string(runes[1:])
+	}
+	return prefix + i.Name
+}
+
+// interfaceType is how generated code refers to the wrapped interface i.e. logic.IRepo[T]
+func interfaceType(i Interface) string {
+	if i.Package == "" {
+		return i.Name + typeParamNames(i.TypeParams)
+	}
+	return i.Package + "." + i.Name + typeParamNames(i.TypeParams)
+}
+
+// paramList declares the params of m i.e. id string, opts ...string
+func paramList(m Method) string {
+	paramString := []string{}
+	for _, p := range m.Params {
+		paramString = append(paramString, p.Name+" "+p.Type)
+	}
+	return strings.Join(paramString, ", ")
+}
+
+// argList forwards the params of m to another call i.e. id, opts...
+func argList(m Method) string {
+	callString := []string{}
+	for _, p := range m.Params {
+		if p.Kind == Variadic {
+			callString = append(callString, p.Name+"...")
+		} else {
+			callString = append(callString, p.Name)
+		}
+	}
+	return strings.Join(callString, ", ")
+}
+
+// errorResult finds the error returned last by m, if it returns one.
+func errorResult(m Method) (Param, bool) {
+	if len(m.Returns) == 0 || m.Returns[len(m.Returns)-1].Type != "error" {
+		return Param{}, false
+	}
+	return m.Returns[len(m.Returns)-1], true
+}
+
+// contextParam finds the context m takes, if it takes one.
+func contextParam(m Method) (Param, bool) {
+	for _, p := range m.Params {
+		if p.Type == "context.Context" {
+			return p, true
+		}
+	}
+	return Param{}, false
+}
+
+// returnNames lists the named results of m i.e. r0, r1
+func returnNames(m Method) string {
+	names := []string{}
+	for _, r := range m.Returns {
+		names = append(names, r.Name)
+	}
+	return strings.Join(names, ", ")
+}
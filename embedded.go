@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// interfaceSource is the file an interface was declared in. It knows how to
+// qualify the identifiers of that file and where to look for embedded interfaces.
+type interfaceSource struct {
+	Package string // qualifier for identifiers declared in the source package
+	Dir     string
+	File    *ast.File
+	Imports *importSet // collects the imports of every file methods are taken from
+}
+
+func (src interfaceSource) key(name string) string {
+	return src.Dir + "." + name
+}
+
+// methods flattens the methods of iface, resolving embedded interfaces from the
+// same file, the same package or an imported package. Embedded generic interfaces
+// i.e. Getter[T] get their type arguments put in place of their type parameters.
+func (src interfaceSource) methods(iface *ast.InterfaceType, typeParams []string, visited map[string]bool) ([]Method, error) {
+	methods := []Method{}
+	for _, member := range iface.Methods.List {
+		if len(member.Names) != 0 {
+			meth, success := methodFromField(member, src.Package, typeParams)
+			if success {
+				methods = appendMethod(methods, meth)
+			}
+			continue
+		}
+
+		// embedded interface i.e. io.Closer
+		if ident, success := member.Type.(*ast.Ident); success && ident.Name == "error" {
+			errMethod := Method{Name: "Error", Returns: []Param{{Type: "string", Kind: Value}}}
+			methods = appendMethod(methods, errMethod)
+			continue
+		}
+		if ident, success := member.Type.(*ast.Ident); success && ident.Name == "any" {
+			continue
+		}
+
+		embeddedType := member.Type
+		typeArgs := []ast.Expr{}
+		switch t := member.Type.(type) {
+		case *ast.IndexExpr: // Getter[T]
+			embeddedType = t.X
+			typeArgs = []ast.Expr{t.Index}
+		case *ast.IndexListExpr: // Pair[K, V]
+			embeddedType = t.X
+			typeArgs = t.Indices
+		}
+
+		embedded, embeddedSrc, success := src.lookup(embeddedType)
+		if !success {
+			return nil, fmt.Errorf("could not resolve embedded interface %s", types.ExprString(member.Type))
+		}
+		name := embedded.Name.Name
+		if visited[embeddedSrc.key(name)] {
+			continue
+		}
+		visited[embeddedSrc.key(name)] = true
+
+		_, embeddedTypeParams := typeParamsOf(embedded, embeddedSrc.Package)
+		if len(typeArgs) != len(embeddedTypeParams) {
+			return nil, fmt.Errorf("embedded interface %s takes %d type arguments", types.ExprString(member.Type), len(embeddedTypeParams))
+		}
+		args := []string{}
+		for _, typeArg := range typeArgs {
+			arg := typeFromField(typeArg, src.Package, true, typeParams)
+			if !arg.Success {
+				return nil, fmt.Errorf("could not resolve the type arguments of embedded interface %s", types.ExprString(member.Type))
+			}
+			args = append(args, arg.Type)
+		}
+
+		embeddedMethods, err := embeddedSrc.methods(embedded.Type.(*ast.InterfaceType), embeddedTypeParams, visited)
+		if err != nil {
+			return nil, err
+		}
+		for _, meth := range embeddedMethods {
+			methods = appendMethod(methods, instantiateMethod(meth, embeddedTypeParams, args))
+		}
+	}
+	return methods, nil
+}
+
+// instantiateMethod puts the type arguments args in place of the type parameters named
+// typeParams in the signature of meth.
+func instantiateMethod(meth Method, typeParams []string, args []string) Method {
+	if len(typeParams) == 0 {
+		return meth
+	}
+	substitutions := map[string]string{}
+	for idx, name := range typeParams {
+		substitutions[name] = args[idx]
+	}
+	instantiate := func(params []Param) []Param {
+		instantiated := []Param{}
+		for _, p := range params {
+			p.Type = substituteIdents(p.Type, substitutions)
+			instantiated = append(instantiated, p)
+		}
+		return instantiated
+	}
+	meth.Params = instantiate(meth.Params)
+	meth.Returns = instantiate(meth.Returns)
+	return meth
+}
+
+// substituteIdents replaces the unqualified identifiers in typeString that substitutions has
+// a replacement for i.e. map[K][]V becomes map[string][]domain.User
+func substituteIdents(typeString string, substitutions map[string]string) string {
+	isIdentRune := func(r rune) bool { return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) }
+	runes := []rune(typeString)
+	out := ""
+	for idx := 0; idx < len(runes); {
+		if !isIdentRune(runes[idx]) {
+			out = out + string(runes[idx])
+			idx++
+			continue
+		}
+		end := idx
+		for end < len(runes) && isIdentRune(runes[end]) {
+			end++
+		}
+		ident := string(runes[idx:end])
+		replacement, success := substitutions[ident]
+		if success && (idx == 0 || runes[idx-1] != '.') {
+			ident = replacement
+		}
+		out = out + ident
+		idx = end
+	}
+	return out
+}
+
+// appendMethod adds meth unless a method with the same name is already present,
+// as happens when two embedded interfaces share a method.
+func appendMethod(methods []Method, meth Method) []Method {
+	for _, m := range methods {
+		if m.Name == meth.Name {
+			return methods
+		}
+	}
+	return append(methods, meth)
+}
+
+// lookup finds the declaration of an embedded interface.
+func (src interfaceSource) lookup(expr ast.Expr) (*ast.TypeSpec, interfaceSource, bool) {
+	switch t := expr.(type) {
+	case *ast.Ident: // same file or same package
+		if spec, success := findInterface(src.File, t.Name); success {
+			return spec, src, true
+		}
+		files := parsePackageDir(src.Dir, src.File.Name.Name)
+		for _, f := range files {
+			if spec, success := findInterface(f, t.Name); success {
+				src.Imports.addFile(f)
+				return spec, interfaceSource{Package: src.Package, Dir: src.Dir, File: f, Imports: src.Imports}, true
+			}
+		}
+	case *ast.SelectorExpr: // imported package
+		pkgIdent, success := t.X.(*ast.Ident)
+		if !success {
+			break
+		}
+		importPath, success := importPathFor(src.File, pkgIdent.Name)
+		if !success {
+			break
+		}
+		pkg, err := build.Import(importPath, src.Dir, 0)
+		if err != nil {
+			break
+		}
+		for _, f := range parsePackageDir(pkg.Dir, pkg.Name) {
+			if spec, success := findInterface(f, t.Sel.Name); success {
+				src.Imports.addFile(f)
+				return spec, interfaceSource{Package: pkgIdent.Name, Dir: pkg.Dir, File: f, Imports: src.Imports}, true
+			}
+		}
+	}
+	return nil, src, false
+}
+
+// importPathFor finds the import path the file refers to by name.
+func importPathFor(f *ast.File, name string) (string, bool) {
+	for _, imp := range f.Imports {
+		importPath, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+		if imp.Name != nil {
+			if imp.Name.Name == name {
+				return importPath, true
+			}
+			continue
+		}
+		if importPath == name || strings.HasSuffix(importPath, "/"+name) {
+			return importPath, true
+		}
+		pkg, err := build.Import(importPath, "", build.ImportComment)
+		if err == nil && pkg.Name == name {
+			return importPath, true
+		}
+	}
+	return "", false
+}
+
+// findInterface finds the declaration of the interface called name in f.
+func findInterface(f *ast.File, name string) (*ast.TypeSpec, bool) {
+	for _, decl := range f.Decls {
+		genDecl, success := decl.(*ast.GenDecl)
+		if !success || genDecl.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			typeSpec, success := spec.(*ast.TypeSpec)
+			if !success || typeSpec.Name.Name != name {
+				continue
+			}
+			_, success = typeSpec.Type.(*ast.InterfaceType)
+			return typeSpec, success
+		}
+	}
+	return nil, false
+}
+
+// parsePackageDir parses the non-test go files in dir that belong to package pkgName.
+func parsePackageDir(dir string, pkgName string) []*ast.File {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	files := []*ast.File{}
+	fset := token.NewFileSet()
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.ParseComments)
+		if err != nil || f.Name.Name != pkgName {
+			continue
+		}
+		files = append(files, f)
+	}
+	return files
+}
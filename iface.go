@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// makeInterface writes an interface of the exported method set of typeName, declared with
+// value or pointer receivers in any file of the package at source (a file or its dir), or
+// promoted from the fields it embeds. When mockFile isn't empty the mock of the new interface
+// is generated into it as well.
+func makeInterface(source string, typeName string, outFile string, mockFile string, opts MockOptions) error {
+	dir := source
+	if info, err := os.Stat(source); err == nil && !info.IsDir() {
+		dir = filepath.Dir(source)
+	}
+
+	bp, err := build.ImportDir(dir, 0)
+	if err != nil {
+		return err
+	}
+	files := []*ast.File{}
+	fset := token.NewFileSet()
+	for _, name := range bp.GoFiles {
+		f, err := parser.ParseFile(fset, filepath.Join(bp.Dir, name), nil, parser.ParseComments)
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+	}
+
+	imports := newImportSet()
+	for _, f := range files {
+		imports.addFile(f)
+	}
+
+	// an interface written next to the type shares its package, otherwise it imports it
+	outPackage := bp.Name
+	qualifier := ""
+	if !sameDir(filepath.Join(dir, "x.go"), outFile) {
+		outPackage = outputPackage(outFile)
+		importPath, success := dirImportPath(dir)
+		if !success {
+			fmt.Printf("WARNING: could not find the import path of %s\n", dir)
+			importPath = bp.Name
+		}
+		qualifier = imports.add(bp.Name, importPath)
+	}
+
+	typeSpec, success := findType(files, typeName)
+	if !success {
+		return fmt.Errorf("%s has no type %s", dir, typeName)
+	}
+	i := Interface{Name: "I" + typeName, Package: qualifier}
+	var typeParamNames []string
+	i.TypeParams, typeParamNames = typeParamsOf(typeSpec, qualifier)
+
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			funcDecl, success := decl.(*ast.FuncDecl)
+			if !success || !funcDecl.Name.IsExported() {
+				continue
+			}
+			if recv, _ := receiverType(funcDecl); recv != typeName {
+				continue
+			}
+			i.Methods = append(i.Methods, methodFromFunc(funcDecl, qualifier, typeParamNames))
+		}
+	}
+	if hasEmbeddedField(typeSpec) {
+		promoted, err := promotedMethods(dir, typeName, imports, sameDir(filepath.Join(dir, "x.go"), outFile))
+		if err != nil {
+			return err
+		}
+		i.Methods = append(i.Methods, promoted...)
+	}
+	if len(i.Methods) == 0 {
+		return fmt.Errorf("%s has no exported methods", typeName)
+	}
+
+	out := fmt.Sprintf("// Generated by Rawdog\n\npackage %s\n\n%s", outPackage, buildInterface(i, typeName))
+	if err := os.MkdirAll(filepath.Dir(outFile), 0755); err != nil {
+		return err
+	}
+	if err := writeGoFile(outFile, out, imports); err != nil {
+		return err
+	}
+
+	if mockFile == "" {
+		return nil
+	}
+	return makeMocks(outFile, mockFile, opts)
+}
+
+// hasEmbeddedField reports whether the type declared by typeSpec is a struct embedding a field,
+// whose methods are promoted to it.
+func hasEmbeddedField(typeSpec *ast.TypeSpec) bool {
+	structType, success := typeSpec.Type.(*ast.StructType)
+	if !success {
+		return false
+	}
+	for _, field := range structType.Fields.List {
+		if len(field.Names) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// promotedMethods are the exported methods typeName gets from the fields it embeds, at any
+// depth. Only type checking the package tells which ones the type doesn't shadow. Errors in
+// the rest of the package, like code using the interface that's about to be generated, don't
+// matter as long as the embedded fields type check. sameDirOutput leaves the types of the
+// package unqualified.
+func promotedMethods(dir string, typeName string, imports *importSet, sameDirOutput bool) ([]Method, error) {
+	pkg, docs, err := loadPackage(dir)
+	if pkg == nil {
+		return nil, fmt.Errorf("%s embeds fields, finding their methods: %v", typeName, err)
+	}
+	obj, success := pkg.Scope().Lookup(typeName).(*types.TypeName)
+	if !success {
+		return nil, fmt.Errorf("%s has no type %s", dir, typeName)
+	}
+	if structType, success := obj.Type().Underlying().(*types.Struct); success {
+		for idx := 0; idx < structType.NumFields(); idx++ {
+			field := structType.Field(idx)
+			fieldType := field.Type()
+			if pointer, success := fieldType.(*types.Pointer); success {
+				fieldType = pointer.Elem()
+			}
+			if field.Embedded() && fieldType == types.Typ[types.Invalid] {
+				return nil, fmt.Errorf("%s embeds %s, which doesn't type check: %v", typeName, field.Name(), err)
+			}
+		}
+	}
+	outputPath := ""
+	if sameDirOutput {
+		outputPath = pkg.Path()
+	}
+	qualifier := imports.qualifier(outputPath)
+
+	methods := []Method{}
+	methodSet := types.NewMethodSet(types.NewPointer(obj.Type()))
+	for idx := 0; idx < methodSet.Len(); idx++ {
+		selection := methodSet.At(idx)
+		// methods declared on the type itself were collected from its source already
+		if len(selection.Index()) == 1 || !selection.Obj().Exported() {
+			continue
+		}
+		methods = append(methods, methodFromTypes(selection.Obj().(*types.Func), qualifier, docs))
+	}
+	return methods, nil
+}
+
+// findType finds the declaration of the type called name in any of files.
+func findType(files []*ast.File, name string) (*ast.TypeSpec, bool) {
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			genDecl, success := decl.(*ast.GenDecl)
+			if !success || genDecl.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range genDecl.Specs {
+				typeSpec := spec.(*ast.TypeSpec)
+				if typeSpec.Name.Name == name {
+					return typeSpec, true
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+// receiverType names the type a method is declared on and reports whether its receiver is a
+// pointer, i.e. AccountService for func (s *AccountService) or Store for func (s Store[K, V]).
+func receiverType(funcDecl *ast.FuncDecl) (string, bool) {
+	if funcDecl.Recv == nil || len(funcDecl.Recv.List) == 0 {
+		return "", false
+	}
+
+	expr := funcDecl.Recv.List[0].Type
+	isPointer := false
+	if star, success := expr.(*ast.StarExpr); success {
+		expr = star.X
+		isPointer = true
+	}
+	switch t := expr.(type) {
+	case *ast.IndexExpr: // generic receiver with one type parameter
+		expr = t.X
+	case *ast.IndexListExpr:
+		expr = t.X
+	}
+	if ident, success := expr.(*ast.Ident); success {
+		return ident.Name, isPointer
+	}
+	return "", false
+}
+
+// methodFromFunc builds a Method from a method declaration.
+func methodFromFunc(funcDecl *ast.FuncDecl, packageName string, typeParams []string) Method {
+	meth := Method{Name: funcDecl.Name.Name, Doc: docLines(funcDecl.Doc), Directives: directives(funcDecl.Doc)}
+
+	ftype := funcDecl.Type
+	for _, param := range ftype.Params.List { //method params
+		p := paramFromMember(param, packageName, typeParams)
+		meth.Params = append(meth.Params, p...)
+	}
+	if ftype.Results != nil { // checks whether method returns anything
+		for _, result := range ftype.Results.List {
+			r := paramFromMember(result, packageName, typeParams)
+			meth.Returns = append(meth.Returns, r...)
+		}
+	}
+	return synthesizeParamNames(meth)
+}
+
+// docLines splits a doc comment into its lines, dropping the comment markers. A comment of
+// directives alone has no lines.
+func docLines(doc *ast.CommentGroup) []string {
+	if doc == nil || doc.Text() == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(doc.Text(), "\n"), "\n")
+}
+
+// directives finds the rawdog annotations in a doc comment, which its text leaves out.
+func directives(doc *ast.CommentGroup) []string {
+	found := []string{}
+	if doc == nil {
+		return found
+	}
+	for _, c := range doc.List {
+		if strings.HasPrefix(c.Text, "//rawdog:") {
+			found = append(found, strings.TrimSpace(strings.TrimPrefix(c.Text, "//")))
+		}
+	}
+	return found
+}
+
+// hasDirective reports whether m was annotated with directive i.e. rawdog:noretry
+func hasDirective(m Method, directive string) bool {
+	for _, d := range m.Directives {
+		if d == directive {
+			return true
+		}
+	}
+	return false
+}
+
+// directiveComment writes annotations back out, so they carry over to generated interfaces.
+func directiveComment(directives []string, indent string) string {
+	comment := ""
+	for _, d := range directives {
+		comment = fmt.Sprintf("%s%s//%s\n", comment, indent, d)
+	}
+	return comment
+}
+
+// docComment writes doc lines back out as a comment, indented by indent.
+func docComment(doc []string, indent string) string {
+	comment := ""
+	for _, line := range doc {
+		comment = fmt.Sprintf("%s%s// %s\n", comment, indent, line)
+	}
+	return strings.ReplaceAll(comment, "// \n", "//\n")
+}
+
+func buildInterface(i Interface, typeName string) string {
+	iface := fmt.Sprintf("// %s is the exported method set of %s.\n", i.Name, typeName)
+	iface = fmt.Sprintf("%stype %s%s interface {\n", iface, i.Name, typeParamDecl(i.TypeParams))
+	for idx, m := range i.Methods {
+		if idx > 0 && len(m.Doc)+len(m.Directives) > 0 {
+			iface = fmt.Sprintf("%s\n", iface)
+		}
+		iface = fmt.Sprintf("%s%s%s\t%s", iface, docComment(m.Doc, "\t"), directiveComment(m.Directives, "\t"), InterfaceMethod(i.Name, m))
+	}
+	iface = fmt.Sprintf("%s}\n", iface)
+	return iface
+}
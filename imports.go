@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// stdImports are the standard library packages generated code uses that can't be
+// found from their name alone.
+var stdImports = map[string]string{
+	"driver":   "database/sql/driver",
+	"sql":      "database/sql",
+	"json":     "encoding/json",
+	"http":     "net/http",
+	"httptest": "net/http/httptest",
+	"slog":     "log/slog",
+	"atomic":   "sync/atomic",
+	"fs":       "io/fs",
+}
+
+// appImports are the packages of the app layout rawdog scaffolds for, used when a
+// source file doesn't tell us where they live.
+var appImports = map[string]string{
+	"domain":    "domain",
+	"logic":     "app/webapi/logic",
+	"router":    "lib/router",
+	"mysqlrepo": "adapter/mysqlrepo",
+	"assert":    "github.com/stretchr/testify/assert",
+}
+
+// importSet names the packages generated code refers to, aliasing any whose names
+// clash, so the import block can be written once the code is done.
+type importSet struct {
+	byName map[string]string // local name -> import path
+}
+
+func newImportSet() *importSet {
+	return &importSet{byName: map[string]string{}}
+}
+
+// add registers path under name, or under an alias if another path already has that
+// name, and returns the name code should qualify with.
+func (s *importSet) add(name string, importPath string) string {
+	alias := name
+	for n := 2; ; n++ {
+		existing, taken := s.byName[alias]
+		if !taken || existing == importPath {
+			break
+		}
+		alias = fmt.Sprintf("%s%d", name, n)
+	}
+	s.byName[alias] = importPath
+	return alias
+}
+
+// addFile registers the imports of a parsed source file under the names the file uses.
+func (s *importSet) addFile(f *ast.File) {
+	for _, imp := range f.Imports {
+		importPath, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := path.Base(importPath)
+		if imp.Name != nil {
+			name = imp.Name.Name
+		} else if pkg, err := build.Import(importPath, "", 0); err == nil && pkg.Name != "" {
+			name = pkg.Name
+		}
+		if name == "_" || name == "." {
+			continue
+		}
+		if _, taken := s.byName[name]; !taken {
+			s.byName[name] = importPath
+		}
+	}
+}
+
+// addAll registers every name of imports that isn't already known.
+func (s *importSet) addAll(imports map[string]string) {
+	for name, importPath := range imports {
+		if _, taken := s.byName[name]; !taken {
+			s.byName[name] = importPath
+		}
+	}
+}
+
+// qualifier names packages for types.TypeString, leaving types of the output package unqualified.
+func (s *importSet) qualifier(outputPath string) types.Qualifier {
+	return func(p *types.Package) string {
+		if p.Path() == outputPath {
+			return ""
+		}
+		return s.add(p.Name(), p.Path())
+	}
+}
+
+// resolve finds the import path for a name used in generated code.
+func (s *importSet) resolve(name string) (string, bool) {
+	if importPath, success := s.byName[name]; success {
+		return importPath, true
+	}
+	if importPath, success := stdImports[name]; success {
+		return importPath, true
+	}
+	if pkg, err := build.Import(name, "", build.FindOnly); err == nil && pkg.Goroot {
+		return name, true
+	}
+	return "", false
+}
+
+func addImports(src string, imports *importSet) (string, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return src, err
+	}
+
+	unresolved := map[string]bool{}
+	for _, ident := range f.Unresolved {
+		unresolved[ident.Name] = true
+	}
+	used := map[string]bool{}
+	ast.Inspect(f, func(n ast.Node) bool {
+		sel, success := n.(*ast.SelectorExpr)
+		if !success {
+			return true
+		}
+		if x, success := sel.X.(*ast.Ident); success && unresolved[x.Name] {
+			used[x.Name] = true
+		}
+		return true
+	})
+
+	std := []string{}
+	other := []string{}
+	for name := range used {
+		importPath, success := imports.resolve(name)
+		if !success {
+			fmt.Printf("WARNING: don't know which package to import for %s\n", name)
+			continue
+		}
+		spec := strconv.Quote(importPath)
+		if path.Base(importPath) != name {
+			spec = name + " " + spec
+		}
+		if isStdImport(importPath) {
+			std = append(std, spec)
+		} else {
+			other = append(other, spec)
+		}
+	}
+	if len(std)+len(other) == 0 {
+		return src, nil
+	}
+	sort.Slice(std, func(a, b int) bool { return importPathOf(std[a]) < importPathOf(std[b]) })
+	sort.Slice(other, func(a, b int) bool { return importPathOf(other[a]) < importPathOf(other[b]) })
+
+	groups := []string{}
+	if len(std) > 0 {
+		groups = append(groups, "\t"+strings.Join(std, "\n\t"))
+	}
+	if len(other) > 0 {
+		groups = append(groups, "\t"+strings.Join(other, "\n\t"))
+	}
+	importBlock := fmt.Sprintf("\n\nimport (\n%s\n)", strings.Join(groups, "\n\n"))
+
+	offset := fset.Position(f.Name.End()).Offset
+	return src[:offset] + importBlock + src[offset:], nil
+}
+
+// importPathOf strips the alias from an import spec.
+func importPathOf(spec string) string {
+	return spec[strings.Index(spec, "\""):]
+}
+
+// isStdImport reports whether importPath belongs to the standard library.
+func isStdImport(importPath string) bool {
+	pkg, err := build.Import(importPath, "", build.FindOnly)
+	return err == nil && pkg.Goroot
+}
+
+// sameDir reports whether two files live in the same directory, and so the same package.
+func sameDir(a string, b string) bool {
+	return filepath.Dir(mustAbs(a)) == filepath.Dir(mustAbs(b))
+}
+
+// outputPackage finds the package a generated file belongs in: the package of the go files
+// already in its directory, or else the directory name.
+func outputPackage(output string) string {
+	dir, err := filepath.Abs(filepath.Dir(output))
+	if err != nil {
+		return "mocks"
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), filepath.Join(dir, name), nil, parser.PackageClauseOnly)
+		if err == nil && filepath.Join(dir, name) != mustAbs(output) {
+			return f.Name.Name
+		}
+	}
+	name := strings.ToLower(filepath.Base(dir))
+	name = strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return -1
+	}, name)
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return "mocks"
+	}
+	return name
+}
+
+func mustAbs(p string) string {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return p
+	}
+	return abs
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+)
+
+// instrumentReservedNames are identifiers the generated instrumented methods declare themselves.
+var instrumentReservedNames = []string{"s", "start", "span"}
+
+// makeInstrumentedDecorators writes Instrumented<Name> wrappers that record metrics and start a
+// span for every call to the interfaces in inFile. The Metrics and Tracer they report to are
+// written to instrumentation.go next to outFile.
+func makeInstrumentedDecorators(inFile string, outFile string, selected []string, outPackage string) error {
+	if err := writeSupportFile(outFile, outPackage, "instrumentation.go", instrumentationTemplate, newImportSet()); err != nil {
+		return err
+	}
+	return makeDecorators(inFile, outFile, selected, outPackage, buildInstrumentedDecorator)
+}
+
+func buildInstrumentedDecorator(i Interface) string {
+	name := decoratorName("Instrumented", i)
+	receiverName := name + typeParamNames(i.TypeParams)
+	ifaceType := interfaceType(i)
+
+	dec := fmt.Sprintf("// %s counts calls and errors, observes the latency and starts a span of every call to the %s it wraps.\n", name, i.Name)
+	dec = fmt.Sprintf("%stype %s%s struct {\n", dec, name, typeParamDecl(i.TypeParams))
+	dec = fmt.Sprintf("%s\tnext    %s\n\tmetrics Metrics\n\ttracer  Tracer\n}\n\n", dec, ifaceType)
+
+	dec = fmt.Sprintf("%s// New%s instruments next. Nil metrics or tracer record nothing.\n", dec, name)
+	dec = fmt.Sprintf("%sfunc New%s%s(next %s, metrics Metrics, tracer Tracer) *%s {\n", dec, name, typeParamDecl(i.TypeParams), ifaceType, receiverName)
+	dec = fmt.Sprintf("%s\tif metrics == nil {\n\t\tmetrics = nopMetrics{}\n\t}\n", dec)
+	dec = fmt.Sprintf("%s\tif tracer == nil {\n\t\ttracer = nopTracer{}\n\t}\n", dec)
+	dec = fmt.Sprintf("%s\treturn &%s{next: next, metrics: metrics, tracer: tracer}\n}\n", dec, receiverName)
+
+	for _, m := range i.Methods {
+		m = namedResults(namedParams(m, instrumentReservedNames), instrumentReservedNames)
+		dec = fmt.Sprintf("%s\n%s", dec, buildInstrumentedMethod(i, m, receiverName))
+	}
+	return dec
+}
+
+func buildInstrumentedMethod(i Interface, m Method, receiverName string) string {
+	metric := fmt.Sprintf("\"%s.%s\"", i.Name, m.Name)
+
+	method := docComment(m.Doc, "")
+	method = fmt.Sprintf("%sfunc (s *%s) %s(%s)%s {\n", method, receiverName, m.Name, paramList(m), resultList(m.Returns, true))
+	if ctx, success := contextParam(m); success { // the span goes along with the call
+		method = fmt.Sprintf("%s\t%s, span := s.tracer.Start(%s, %s)\n", method, ctx.Name, ctx.Name, metric)
+	} else {
+		method = fmt.Sprintf("%s\t_, span := s.tracer.Start(context.Background(), %s)\n", method, metric)
+	}
+	method = fmt.Sprintf("%s\tdefer func(start time.Time) {\n", method)
+	method = fmt.Sprintf("%s\t\ts.metrics.IncCalls(%s)\n", method, metric)
+	method = fmt.Sprintf("%s\t\ts.metrics.ObserveLatency(%s, time.Since(start))\n", method, metric)
+	if err, success := errorResult(m); success {
+		method = fmt.Sprintf("%s\t\tif %s != nil {\n\t\t\ts.metrics.IncErrors(%s)\n\t\t}\n", method, err.Name, metric)
+		method = fmt.Sprintf("%s\t\tspan.End(%s)\n", method, err.Name)
+	} else {
+		method = fmt.Sprintf("%s\t\tspan.End(nil)\n", method)
+	}
+	method = fmt.Sprintf("%s\t}(time.Now())\n", method)
+
+	if len(m.Returns) == 0 {
+		method = fmt.Sprintf("%s\ts.next.%s(%s)\n}\n", method, m.Name, argList(m))
+	} else {
+		method = fmt.Sprintf("%s\treturn s.next.%s(%s)\n}\n", method, m.Name, argList(m))
+	}
+	return method
+}
+
+const instrumentationTemplate = `// Metrics records what instrumented decorators observe, by method i.e. IAccountService.ByID
+type Metrics interface {
+	IncCalls(method string)
+	IncErrors(method string)
+	ObserveLatency(method string, d time.Duration)
+}
+
+// Tracer starts a span for every call made through an instrumented decorator.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a traced call. End is called with the error the call returned, if any.
+type Span interface {
+	End(err error)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) IncCalls(method string)                        {}
+func (nopMetrics) IncErrors(method string)                       {}
+func (nopMetrics) ObserveLatency(method string, d time.Duration) {}
+
+type nopTracer struct{}
+
+func (nopTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) End(err error) {}
+
+// MemoryMetrics keeps metrics in memory, for tests.
+type MemoryMetrics struct {
+	mu        sync.Mutex
+	calls     map[string]int
+	errors    map[string]int
+	latencies map[string][]time.Duration
+}
+
+// NewMemoryMetrics returns empty in memory metrics.
+func NewMemoryMetrics() *MemoryMetrics {
+	return &MemoryMetrics{calls: map[string]int{}, errors: map[string]int{}, latencies: map[string][]time.Duration{}}
+}
+
+func (m *MemoryMetrics) IncCalls(method string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls[method]++
+}
+
+func (m *MemoryMetrics) IncErrors(method string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.errors[method]++
+}
+
+func (m *MemoryMetrics) ObserveLatency(method string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.latencies[method] = append(m.latencies[method], d)
+}
+
+// Calls is how many times method was called.
+func (m *MemoryMetrics) Calls(method string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls[method]
+}
+
+// Errors is how many calls to method returned an error.
+func (m *MemoryMetrics) Errors(method string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.errors[method]
+}
+
+// Histogram counts the latencies of method into buckets with the given upper bounds, in
+// increasing order. The extra last bucket counts the latencies above every bound.
+func (m *MemoryMetrics) Histogram(method string, bounds ...time.Duration) []int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	buckets := make([]int, len(bounds)+1)
+	for _, d := range m.latencies[method] {
+		b := 0
+		for b < len(bounds) && d > bounds[b] {
+			b++
+		}
+		buckets[b]++
+	}
+	return buckets
+}
+`
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+)
+
+// loggingReservedNames are identifiers the generated logging methods declare themselves.
+var loggingReservedNames = []string{"s", "start", "level"}
+
+// makeLoggingDecorators writes Logging<Name> wrappers that log every call to the interfaces
+// in inFile through a *slog.Logger.
+func makeLoggingDecorators(inFile string, outFile string, selected []string, outPackage string) error {
+	return makeDecorators(inFile, outFile, selected, outPackage, buildLoggingDecorator)
+}
+
+func buildLoggingDecorator(i Interface) string {
+	name := decoratorName("Logging", i)
+	receiverName := name + typeParamNames(i.TypeParams)
+	ifaceType := interfaceType(i)
+
+	dec := fmt.Sprintf("// %s logs the method, arguments, duration and error of every call to the %s it wraps.\n", name, i.Name)
+	dec = fmt.Sprintf("%stype %s%s struct {\n", dec, name, typeParamDecl(i.TypeParams))
+	dec = fmt.Sprintf("%s\tnext   %s\n\tlogger *slog.Logger\n}\n\n", dec, ifaceType)
+
+	dec = fmt.Sprintf("%s// New%s logs the calls to next through logger, or slog.Default() when logger is nil.\n", dec, name)
+	dec = fmt.Sprintf("%sfunc New%s%s(next %s, logger *slog.Logger) *%s {\n", dec, name, typeParamDecl(i.TypeParams), ifaceType, receiverName)
+	dec = fmt.Sprintf("%s\tif logger == nil {\n\t\tlogger = slog.Default()\n\t}\n", dec)
+	dec = fmt.Sprintf("%s\treturn &%s{next: next, logger: logger}\n}\n", dec, receiverName)
+
+	for _, m := range i.Methods {
+		m = namedResults(namedParams(m, loggingReservedNames), loggingReservedNames)
+		dec = fmt.Sprintf("%s\n%s", dec, buildLoggingMethod(i, m, receiverName))
+	}
+	return dec
+}
+
+func buildLoggingMethod(i Interface, m Method, receiverName string) string {
+	ctx := "context.Background()"
+	if p, success := contextParam(m); success {
+		ctx = p.Name
+	}
+	attrs := fmt.Sprintf("\"method\", \"%s.%s\"", i.Name, m.Name)
+	for _, p := range m.Params {
+		if p.Type != "context.Context" {
+			attrs = fmt.Sprintf("%s, \"%s\", %s", attrs, p.Name, p.Name)
+		}
+	}
+	attrs = fmt.Sprintf("%s, \"duration\", time.Since(start)", attrs)
+
+	method := docComment(m.Doc, "")
+	method = fmt.Sprintf("%sfunc (s *%s) %s(%s)%s {\n", method, receiverName, m.Name, paramList(m), resultList(m.Returns, true))
+	method = fmt.Sprintf("%s\tdefer func(start time.Time) {\n", method)
+	if err, success := errorResult(m); success {
+		method = fmt.Sprintf("%s\t\tlevel := slog.LevelInfo\n", method)
+		method = fmt.Sprintf("%s\t\tif %s != nil {\n\t\t\tlevel = slog.LevelError\n\t\t}\n", method, err.Name)
+		method = fmt.Sprintf("%s\t\ts.logger.Log(%s, level, \"call\", %s, \"err\", %s)\n", method, ctx, attrs, err.Name)
+	} else {
+		method = fmt.Sprintf("%s\t\ts.logger.Log(%s, slog.LevelInfo, \"call\", %s)\n", method, ctx, attrs)
+	}
+	method = fmt.Sprintf("%s\t}(time.Now())\n", method)
+
+	if len(m.Returns) == 0 {
+		method = fmt.Sprintf("%s\ts.next.%s(%s)\n}\n", method, m.Name, argList(m))
+	} else {
+		method = fmt.Sprintf("%s\treturn s.next.%s(%s)\n}\n", method, m.Name, argList(m))
+	}
+	return method
+}
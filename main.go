@@ -2,40 +2,123 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"io/ioutil"
+	"os"
 	"strings"
 )
 
 func main() {
 
 	var isMockPtr *bool = nil
+	var isStrictPtr *bool = nil
+	var mockFromPtr *string = nil
+	var mockOutPtr *string = nil
+	var mockPkgPtr *string = nil
+	var isIfacePtr *bool = nil
+	var isLoggingPtr *bool = nil
+	var isInstrumentPtr *bool = nil
+	var isRetryPtr *bool = nil
+	var isCachePtr *bool = nil
 	var isServicePtr *bool = nil
 	var isControllerPtr *bool = nil
+	var routerPtr *string = nil
 	var isDBServicePtr *bool = nil
 	var isDBServiceDir *bool = nil
 	var isDBTestPtr *bool = nil
 	var isDBTestDir *bool = nil
-
-	isMockPtr = flag.Bool("m", false, "makes mocks from interfaces. rawdog -m <infile> <outfile to generate>")
+	var isContextPtr *bool = nil
+
+	isMockPtr = flag.Bool("m", false, "makes mocks from interfaces. rawdog -m <infile> <outfile to generate> or rawdog -m <package dir> <outfile to generate> [interfaces...]")
+	isStrictPtr = flag.Bool("strict", false, "makes strict mocks that fail the test on unexpected calls. rawdog -m -strict <infile> <outfile to generate>")
+	mockFromPtr = flag.String("from", "", "makes mocks of interfaces from any importable package. rawdog -m -from io.ReadWriteCloser,net/http.RoundTripper -out <outfile to generate>")
+	mockOutPtr = flag.String("out", "", "the file to generate mocks into when using -from")
+	mockPkgPtr = flag.String("pkg", "", "the package of the generated mocks or decorators. defaults to the package already in the output dir, or its name")
+	isIfacePtr = flag.Bool("iface", false, "makes an interface of the exported methods of a type, and optionally its mock. rawdog -iface <file or package dir> <Type> <outfile to generate> [mock file to generate]")
+	isLoggingPtr = flag.Bool("log", false, "makes decorators that log every call to interfaces through slog. rawdog -log <infile> <outfile to generate> [interfaces...]")
+	isInstrumentPtr = flag.Bool("instrument", false, "makes decorators that record metrics and trace every call to interfaces. rawdog -instrument <infile> <outfile to generate> [interfaces...]")
+	isRetryPtr = flag.Bool("retry", false, "makes retrying and circuit breaking decorators of interfaces. methods annotated //rawdog:noretry aren't retried. rawdog -retry <infile> <outfile to generate> [interfaces...]")
+	isCachePtr = flag.Bool("cache", false, "makes decorators that cache what the All and By methods of interfaces read until Store, Update, Patch or DeleteByID. rawdog -cache <infile> <outfile to generate> [interfaces...]")
 	isServicePtr = flag.Bool("s", false, "makes service from model file. rawdog -s <model file> <service file to generate>")
-	isControllerPtr = flag.Bool("c", false, "creates a controller file with the standard structure. rawdog -c <name of controller> <output dir>")
+	isControllerPtr = flag.Bool("c", false, "creates a controller file with the standard structure and its tests, answering through the service generated by rawdog -s. rawdog -c <name of controller> <output dir> [service file]")
+	routerPtr = flag.String("router", "lib", "the router the controllers add their routes to: lib, stdlib, chi or gorilla. rawdog -c -router chi <name of controller> <output dir> [service file]")
 
 	isDBServicePtr = flag.Bool("db", false, "makes queries from top of db model file (structs). rawdog -db <model file> ")
 	isDBServiceDir = flag.Bool("dbDir", false, "makes queries for all db models in the dir (structs). rawdog -db <dir>")
 	isDBTestPtr = flag.Bool("dbt", false, "makes tests from top of db model file (structs). rawdog -db <model file> ")
 	isDBTestDir = flag.Bool("dbtDir", false, "makes test for all db models in the dir (structs). rawdog -db <dir>")
+	isContextPtr = flag.Bool("ctx", false, "makes every generated query, service and repo method take a context.Context first. rawdog -db -ctx <model file> or rawdog -s -ctx <model file> <service file to generate>")
 
 	flag.Parse()
 
 	files := flag.Args()
 
 	if *isMockPtr {
-		if len(files) != 2 {
+		opts := MockOptions{Strict: *isStrictPtr, Package: *mockPkgPtr}
+		if *mockFromPtr != "" {
+			if *mockOutPtr == "" {
+				flag.Usage()
+			} else {
+				exitOnError(makeExternalMocks(strings.Split(*mockFromPtr, ","), *mockOutPtr, opts))
+			}
+		} else if len(files) < 2 {
+			flag.Usage()
+		} else if info, err := os.Stat(files[0]); err == nil && info.IsDir() {
+			// whole package, optionally followed by the interfaces to mock
+			input := files[0]
+			output := files[1]
+			exitOnError(makePackageMocks(input, output, files[2:], opts))
+		} else if len(files) != 2 {
 			flag.Usage()
 		} else {
 			input := files[0]
 			output := files[1]
-			makeMocks(input, output)
+			exitOnError(makeMocks(input, output, opts))
+		}
+		return
+	}
+	if *isIfacePtr {
+		if len(files) != 3 && len(files) != 4 {
+			flag.Usage()
+		} else {
+			mockFile := ""
+			if len(files) == 4 {
+				mockFile = files[3]
+			}
+			opts := MockOptions{Strict: *isStrictPtr, Package: *mockPkgPtr}
+			exitOnError(makeInterface(files[0], files[1], files[2], mockFile, opts))
+		}
+		return
+	}
+	if *isLoggingPtr {
+		if len(files) < 2 {
+			flag.Usage()
+		} else {
+			exitOnError(makeLoggingDecorators(files[0], files[1], files[2:], *mockPkgPtr))
+		}
+		return
+	}
+	if *isInstrumentPtr {
+		if len(files) < 2 {
+			flag.Usage()
+		} else {
+			exitOnError(makeInstrumentedDecorators(files[0], files[1], files[2:], *mockPkgPtr))
+		}
+		return
+	}
+	if *isRetryPtr {
+		if len(files) < 2 {
+			flag.Usage()
+		} else {
+			exitOnError(makeRetryDecorators(files[0], files[1], files[2:], *mockPkgPtr))
+		}
+		return
+	}
+	if *isCachePtr {
+		if len(files) < 2 {
+			flag.Usage()
+		} else {
+			exitOnError(makeCachedDecorators(files[0], files[1], files[2:], *mockPkgPtr))
 		}
 		return
 	}
@@ -45,19 +128,23 @@ func main() {
 		} else {
 			input := files[0]
 			output := files[1]
-			makeService(input, output)
+			exitOnError(makeService(input, output, *isContextPtr))
 		}
 		return
 	}
 
 	if *isControllerPtr {
-		if len(files) != 2 {
+		if len(files) != 2 && len(files) != 3 {
 			flag.Usage()
 		} else {
 			// not actually files
 			input := files[0]
 			outputDir := files[1]
-			makeController(input, outputDir)
+			serviceFile := ""
+			if len(files) == 3 {
+				serviceFile = files[2]
+			}
+			exitOnError(makeController(input, outputDir, serviceFile, *routerPtr))
 		}
 		return
 	}
@@ -66,7 +153,7 @@ func main() {
 		input := files[0]
 		output := input[0:len(input)-3] + "_generatedQueries.go"
 		//log.Println(output)
-		makeDBService(input, output)
+		exitOnError(makeDBService(input, output, *isContextPtr))
 
 		return
 	}
@@ -75,7 +162,7 @@ func main() {
 		input := files[0]
 		output := input[0:len(input)-3] + "_generated_test.go"
 		//log.Println(output)
-		makeDBTests(input, output)
+		exitOnError(makeDBTests(input, output, *isContextPtr))
 
 		return
 	}
@@ -91,11 +178,11 @@ func main() {
 
 		var input string
 		for _, file := range dirFiles {
-			if file.Name() != ".DS_Store" && file.Name() != "transactor.go" && !strings.HasSuffix(file.Name(), "_generatedQueries.go") && !strings.HasSuffix(file.Name(), "_test.go") {
+			if file.Name() != ".DS_Store" && file.Name() != "transactor.go" && file.Name() != queryErrorsFile && !strings.HasSuffix(file.Name(), "_generatedQueries.go") && !strings.HasSuffix(file.Name(), "_test.go") {
 				//log.Println(file.Name())
 				input = files[0] + "/" + file.Name()
 				output := input[0:len(input)-3] + "_generatedQueries.go"
-				makeDBService(input, output)
+				exitOnError(makeDBService(input, output, *isContextPtr))
 			}
 		}
 		return
@@ -112,11 +199,11 @@ func main() {
 
 		var input string
 		for _, file := range dirFiles {
-			if file.Name() != ".DS_Store" && file.Name() != "transactor.go" && file.Name() != "interface.go" && !strings.HasSuffix(file.Name(), "_generatedTests.go") && !strings.HasSuffix(file.Name(), "_test.go") {
+			if file.Name() != ".DS_Store" && file.Name() != "transactor.go" && file.Name() != "interface.go" && file.Name() != queryErrorsFile && !strings.HasSuffix(file.Name(), "_generatedTests.go") && !strings.HasSuffix(file.Name(), "_test.go") {
 				//log.Println(file.Name())
 				input = files[0] + "/" + file.Name()
 				output := input[0:len(input)-3] + "_generated_test.go"
-				makeDBTests(input, output)
+				exitOnError(makeDBTests(input, output, *isContextPtr))
 			}
 		}
 		return
@@ -126,3 +213,11 @@ func main() {
 
 	flag.Usage()
 }
+
+// exitOnError stops generation with a non-zero exit status when a generator fails.
+func exitOnError(err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		os.Exit(1)
+	}
+}
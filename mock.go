@@ -5,7 +5,8 @@ import (
 	"go/ast"
 	"go/parser"
 	"go/token"
-	"os"
+	"go/types"
+	"path/filepath"
 	"strings"
 )
 
@@ -17,6 +18,13 @@ const (
 	Slice
 	Variadic
 	GoInterface
+	TypeParam
+	Map
+	Chan
+	Func
+	Array
+	GoStruct
+	NamedBasic
 )
 
 type Param struct {
@@ -34,29 +42,83 @@ type Method struct {
 	Name    string
 	Params  []Param
 	Returns []Param
+	Doc     []string // lines of the doc comment in the source, without the slashes
+
+	Directives []string // rawdog annotations of the doc comment i.e. rawdog:noretry
+}
+
+// MockOptions controls the shape of the generated mocks.
+type MockOptions struct {
+	Strict  bool   // unconfigured calls fail the test passed to NewMock<Name>
+	Package string // package clause of the generated file, found from the output dir when empty
 }
 
 type Interface struct {
-	Methods []Method
-	Name    string
-	Package string
+	Methods    []Method
+	Name       string
+	Package    string
+	TypeParams []Param
+	MockName   string // of the mock of the interface, Mock<Name> when empty
+}
+
+// mockNameFor names the mock of i and the types that go with it i.e. MockRepo, MockRepoGetUserCall
+func mockNameFor(i Interface) string {
+	if i.MockName != "" {
+		return i.MockName
+	}
+	return "Mock" + i.Name
+}
+
+func makeMocks(inFile string, outFile string, opts MockOptions) error {
+	interfaces, imports, outPackage, err := fileInterfaces(inFile, outFile, opts.Package)
+	if err != nil {
+		return err
+	}
+
+	allMocks := fmt.Sprintf("// Generated by Rawdog\n\npackage %s\n", outPackage)
+	for _, i := range interfaces {
+		allMocks = fmt.Sprintf("%s\n\n%s", allMocks, buildMock(i, opts))
+	}
+
+	return writeGoFile(outFile, allMocks, imports)
 }
 
-func makeMocks(inFile string, outFile string) {
+// fileInterfaces collects the interfaces with methods declared in inFile, qualified for code
+// generated into outFile, along with the imports they need and the package of outFile.
+// outPackage is found from the output dir unless it's given.
+func fileInterfaces(inFile string, outFile string, outPackage string) ([]Interface, *importSet, string, error) {
 	input := inFile
 	output := outFile
 
-	fset := token.NewFileSet()                      // positions are relative to fset
-	f, err := parser.ParseFile(fset, input, nil, 0) //parser.Trace
+	fset := token.NewFileSet()                                         // positions are relative to fset
+	f, err := parser.ParseFile(fset, input, nil, parser.ParseComments) //parser.Trace
 	if err != nil {
-		fmt.Println(err)
-		return
+		return nil, nil, "", err
 	}
 
 	packageName := f.Name.Name
+	imports := newImportSet()
+	imports.addFile(f)
+
+	// code written next to the interfaces shares their package, otherwise it imports it
+	qualifier := ""
+	if !sameDir(input, output) {
+		if outPackage == "" {
+			outPackage = outputPackage(output)
+		}
+		importPath, success := dirImportPath(filepath.Dir(input))
+		if !success {
+			fmt.Printf("WARNING: could not find the import path of %s\n", input)
+			importPath = packageName
+		}
+		qualifier = imports.add(packageName, importPath)
+	} else {
+		outPackage = packageName
+	}
+	src := interfaceSource{Package: qualifier, Dir: filepath.Dir(input), File: f, Imports: imports}
 
 	// ast.Print(fset, f)
-	allMocks := fmt.Sprintf("// Generated by Rawdog\n")
+	interfaces := []Interface{}
 	for _, decl := range f.Decls {
 		root, success := decl.(*ast.GenDecl)
 
@@ -64,139 +126,311 @@ func makeMocks(inFile string, outFile string) {
 			continue
 		}
 
-		interfaceName := ""
-		methods := []Method{}
-
 		for _, genDecl := range root.Specs {
 			typeSpec, success := genDecl.(*ast.TypeSpec)
 			if !success {
 				continue
 			}
-			if typeSpec.Name.Obj.Kind == ast.Typ { // found the interface
-				interfaceName = typeSpec.Name.Name
-			} else {
-				continue
-			}
 
-			iface, success := typeSpec.Type.(*ast.InterfaceType)
-			if !success {
+			i, success, err := interfaceFromSpec(typeSpec, src)
+			if err != nil {
+				return nil, nil, "", err
+			}
+			if !success || len(i.Methods) == 0 {
 				continue
 			}
 
-			for _, member := range iface.Methods.List {
-				meth := Method{}
-
-				if member.Names[0].Obj.Kind == ast.Fun {
-					meth.Name = member.Names[0].Name
-				}
-
-				ftype, success := member.Type.(*ast.FuncType)
-				if !success {
-					continue
-				}
-				for _, param := range ftype.Params.List { //method params
-					p := paramFromMember(param, packageName)
-					meth.Params = append(meth.Params, p...)
-				}
-				if ftype.Results != nil { // checks whether method returns anything
-					for _, result := range ftype.Results.List { //returns
-						r := paramFromMember(result, packageName)
-						meth.Returns = append(meth.Returns, r...)
-					}
-				}
-				methods = append(methods, meth)
-			}
+			interfaces = append(interfaces, i)
 		}
+	}
 
-		if len(methods) == 0 || interfaceName == "" {
-			continue
-		}
+	return interfaces, imports, outPackage, nil
+}
 
-		i := Interface{}
-		i.Methods = methods
-		i.Name = interfaceName
-		i.Package = packageName
+// interfaceFromSpec collects the methods of an interface declaration, including
+// the methods of any interfaces it embeds. It fails when an embedded interface can't
+// be found, the mock would miss its methods.
+func interfaceFromSpec(typeSpec *ast.TypeSpec, src interfaceSource) (Interface, bool, error) {
+	i := Interface{}
+	if typeSpec.Name.Obj == nil || typeSpec.Name.Obj.Kind != ast.Typ {
+		return i, false, nil
+	}
 
-		allMocks = fmt.Sprintf("%s\n\n%s", allMocks, buildMock(i))
+	iface, success := typeSpec.Type.(*ast.InterfaceType)
+	if !success || isConstraintInterface(iface) {
+		return i, false, nil
 	}
 
-	file, err := os.Create(output)
+	var typeParamNames []string
+	i.TypeParams, typeParamNames = typeParamsOf(typeSpec, src.Package)
+
+	visited := map[string]bool{src.key(typeSpec.Name.Name): true}
+	methods, err := src.methods(iface, typeParamNames, visited)
 	if err != nil {
-		fmt.Printf("ERROR: %v\n", err)
-		return
+		return i, false, fmt.Errorf("%s: %v", typeSpec.Name.Name, err)
 	}
-	defer file.Close()
+	i.Methods = methods
+	i.Name = typeSpec.Name.Name
+	i.Package = src.Package
+
+	return i, true, nil
+}
 
-	file.WriteString(allMocks)
-	// fmt.Println(allMocks)
+// typeParamsOf returns the type parameters of a generic declaration i.e. Repo[T any],
+// along with just their names.
+func typeParamsOf(typeSpec *ast.TypeSpec, packageName string) ([]Param, []string) {
+	typeParams := []Param{}
+	names := []string{}
+	if typeSpec.TypeParams == nil {
+		return typeParams, names
+	}
+	for _, field := range typeSpec.TypeParams.List {
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+	}
+	for _, field := range typeSpec.TypeParams.List {
+		typeParams = append(typeParams, paramFromMember(field, packageName, names)...)
+	}
+	return typeParams, names
 }
 
-func typeFromField(i interface{}, pkg string, checkPrimitive bool) innerParam {
+// methodFromField builds a Method from an interface member that declares a method.
+func methodFromField(member *ast.Field, packageName string, typeParams []string) (Method, bool) {
+	meth := Method{}
+
+	if member.Names[0].Obj.Kind == ast.Fun {
+		meth.Name = member.Names[0].Name
+	}
+	meth.Doc = docLines(member.Doc)
+	meth.Directives = directives(member.Doc)
+
+	ftype, success := member.Type.(*ast.FuncType)
+	if !success {
+		return meth, false
+	}
+	for _, param := range ftype.Params.List { //method params
+		p := paramFromMember(param, packageName, typeParams)
+		meth.Params = append(meth.Params, p...)
+	}
+	if ftype.Results != nil { // checks whether method returns anything
+		for _, result := range ftype.Results.List { //returns
+			r := paramFromMember(result, packageName, typeParams)
+			meth.Returns = append(meth.Returns, r...)
+		}
+	}
+	return synthesizeParamNames(meth), true
+}
+
+func typeFromField(i interface{}, pkg string, checkPrimitive bool, typeParams []string) innerParam {
 	p := innerParam{}
 
-	// value
-	rVType, success := i.(*ast.Ident)
-	if success {
-		if !checkPrimitive || IsPrimitive(rVType.Name) {
-			p.Type = rVType.Name
+	switch t := i.(type) {
+	case *ast.Ident: // value
+		if isTypeParam(t.Name, typeParams) {
+			p.Type = t.Name
+			p.Kind = TypeParam
+			p.Success = true
+			return p
+		}
+
+		if !checkPrimitive || IsPrimitive(t.Name) || pkg == "" {
+			p.Type = t.Name
 		} else {
-			p.Type = pkg + "." + rVType.Name
+			p.Type = pkg + "." + t.Name
 		}
 
 		p.Kind = Value
+		if t.Name == "any" {
+			p.Kind = GoInterface
+		}
 		p.Success = true
-	}
 
-	//slice
-	sType, success := i.(*ast.ArrayType)
-	if success {
-		inner := typeFromField(sType.Elt, pkg, true)
-		if inner.Success {
+	case *ast.ArrayType: // slice or fixed size array i.e. [4]byte
+		inner := typeFromField(t.Elt, pkg, true, typeParams)
+		if !inner.Success {
+			return p
+		}
+		if t.Len == nil {
 			p.Type = "[]" + inner.Type
 			p.Kind = Slice
+		} else {
+			p.Type = "[" + arrayLen(t.Len, pkg) + "]" + inner.Type
+			p.Kind = Array
+		}
+		p.Success = true
+
+	case *ast.MapType: // map[string][]*domain.User
+		key := typeFromField(t.Key, pkg, true, typeParams)
+		value := typeFromField(t.Value, pkg, true, typeParams)
+		if key.Success && value.Success {
+			p.Type = "map[" + key.Type + "]" + value.Type
+			p.Kind = Map
 			p.Success = true
 		}
-	}
 
-	//pointer
-	rType, success := i.(*ast.StarExpr)
-	if success {
-		inner := typeFromField(rType.X, pkg, true)
+	case *ast.ChanType: // chan Event, chan<- Event, <-chan Event
+		inner := typeFromField(t.Value, pkg, true, typeParams)
+		if !inner.Success {
+			return p
+		}
+		switch t.Dir {
+		case ast.SEND:
+			p.Type = "chan<- " + inner.Type
+		case ast.RECV:
+			p.Type = "<-chan " + inner.Type
+		default:
+			if strings.HasPrefix(inner.Type, "<-chan") { // chan (<-chan T) needs the parens
+				p.Type = "chan (" + inner.Type + ")"
+			} else {
+				p.Type = "chan " + inner.Type
+			}
+		}
+		p.Kind = Chan
+		p.Success = true
+
+	case *ast.FuncType: // func(ctx context.Context) error
+		params, success := fieldListString(t.Params, pkg, typeParams)
+		if !success {
+			return p
+		}
+		results, success := fieldListString(t.Results, pkg, typeParams)
+		if !success {
+			return p
+		}
+		p.Type = "func(" + params + ")"
+		if t.Results != nil && len(t.Results.List) == 1 && len(t.Results.List[0].Names) == 0 {
+			p.Type = p.Type + " " + results
+		} else if t.Results != nil && len(t.Results.List) > 0 {
+			p.Type = p.Type + " (" + results + ")"
+		}
+		p.Kind = Func
+		p.Success = true
+
+	case *ast.StarExpr: // pointer
+		inner := typeFromField(t.X, pkg, true, typeParams)
 		if inner.Success {
 			p.Type = "*" + inner.Type
-
 			p.Kind = Pointer
 			p.Success = true
 		}
-	}
-
-	//variadic -- as per golang can never be a return!
-	eType, success := i.(*ast.Ellipsis)
-	if success {
-		inner := typeFromField(eType.Elt, pkg, true)
 
+	case *ast.Ellipsis: // variadic -- as per golang can never be a return!
+		inner := typeFromField(t.Elt, pkg, true, typeParams)
 		if inner.Success {
 			p.Type = "..." + inner.Type
-
 			p.Kind = Variadic
 			p.Success = true
 		}
-	}
 
-	//interface{}
-	_, success = i.(*ast.InterfaceType)
-	if success {
-		p.Type = "interface{}"
+	case *ast.InterfaceType: // interface{} or an inline interface i.e. interface{ Close() error }
+		if t.Methods == nil || len(t.Methods.List) == 0 {
+			p.Type = "interface{}"
+		} else {
+			members := []string{}
+			for _, member := range t.Methods.List {
+				if len(member.Names) == 0 { // embedded interface or type set
+					inner := typeFromField(member.Type, pkg, true, typeParams)
+					if !inner.Success {
+						return p
+					}
+					members = append(members, inner.Type)
+					continue
+				}
+				inner := typeFromField(member.Type, pkg, true, typeParams)
+				if !inner.Success {
+					return p
+				}
+				members = append(members, member.Names[0].Name+strings.TrimPrefix(inner.Type, "func"))
+			}
+			p.Type = "interface{ " + strings.Join(members, "; ") + " }"
+		}
 		p.Kind = GoInterface
 		p.Success = true
-	}
 
-	// custom interface i.e. sql.Result
-	cType, success := i.(*ast.SelectorExpr)
-	if success {
-		inner := typeFromField(cType.X, pkg, false)
-		if success {
-			p.Type = inner.Type + "." + cType.Sel.Name
+	case *ast.StructType: // struct{} or an inline struct
+		fields := []string{}
+		for _, field := range t.Fields.List {
+			inner := typeFromField(field.Type, pkg, true, typeParams)
+			if !inner.Success {
+				return p
+			}
+			names := []string{}
+			for _, name := range field.Names {
+				names = append(names, name.Name)
+			}
+			fieldStr := inner.Type
+			if len(names) > 0 {
+				fieldStr = strings.Join(names, ", ") + " " + inner.Type
+			}
+			if field.Tag != nil {
+				fieldStr = fieldStr + " " + field.Tag.Value
+			}
+			fields = append(fields, fieldStr)
+		}
+		if len(fields) == 0 {
+			p.Type = "struct{}"
+		} else {
+			p.Type = "struct{ " + strings.Join(fields, "; ") + " }"
+		}
+		p.Kind = GoStruct
+		p.Success = true
+
+	case *ast.SelectorExpr: // custom interface i.e. sql.Result
+		inner := typeFromField(t.X, pkg, false, typeParams)
+		if inner.Success {
+			p.Type = inner.Type + "." + t.Sel.Name
+			p.Kind = Value
+			p.Success = true
+		}
+
+	case *ast.ParenExpr: // (T)
+		return typeFromField(t.X, pkg, checkPrimitive, typeParams)
+
+	case *ast.IndexExpr: // instantiated generic type i.e. Page[T]
+		inner := typeFromField(t.X, pkg, true, typeParams)
+		arg := typeFromField(t.Index, pkg, true, typeParams)
+		if inner.Success && arg.Success {
+			p.Type = inner.Type + "[" + arg.Type + "]"
+			p.Kind = Value
+			p.Success = true
+		}
+
+	case *ast.IndexListExpr: // instantiated generic type with several arguments i.e. Pair[K, V]
+		inner := typeFromField(t.X, pkg, true, typeParams)
+		args := []string{}
+		for _, index := range t.Indices {
+			arg := typeFromField(index, pkg, true, typeParams)
+			if !arg.Success {
+				return p
+			}
+			args = append(args, arg.Type)
+		}
+		if inner.Success {
+			p.Type = inner.Type + "[" + strings.Join(args, ", ") + "]"
+			p.Kind = Value
+			p.Success = true
+		}
+
+	case *ast.BinaryExpr: // constraint union i.e. ~int | ~float64
+		if t.Op != token.OR {
+			return p
+		}
+		left := typeFromField(t.X, pkg, true, typeParams)
+		right := typeFromField(t.Y, pkg, true, typeParams)
+		if left.Success && right.Success {
+			p.Type = left.Type + " | " + right.Type
+			p.Kind = Value
+			p.Success = true
+		}
+
+	case *ast.UnaryExpr: // constraint approximation i.e. ~int
+		if t.Op != token.TILDE {
+			return p
+		}
+		inner := typeFromField(t.X, pkg, true, typeParams)
+		if inner.Success {
+			p.Type = "~" + inner.Type
 			p.Kind = Value
 			p.Success = true
 		}
@@ -205,12 +439,80 @@ func typeFromField(i interface{}, pkg string, checkPrimitive bool) innerParam {
 	return p
 }
 
-func paramFromMember(param *ast.Field, packageName string) []Param {
+// fieldListString renders the params or results of a func type, keeping their names.
+func fieldListString(fields *ast.FieldList, pkg string, typeParams []string) (string, bool) {
+	if fields == nil {
+		return "", true
+	}
+	fieldStrs := []string{}
+	for _, field := range fields.List {
+		inner := typeFromField(field.Type, pkg, true, typeParams)
+		if !inner.Success {
+			return "", false
+		}
+		if len(field.Names) == 0 {
+			fieldStrs = append(fieldStrs, inner.Type)
+			continue
+		}
+		names := []string{}
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+		fieldStrs = append(fieldStrs, strings.Join(names, ", ")+" "+inner.Type)
+	}
+	return strings.Join(fieldStrs, ", "), true
+}
+
+// arrayLen renders the length of an array type, qualifying named constants.
+func arrayLen(expr ast.Expr, pkg string) string {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		if pkg == "" {
+			return t.Name
+		}
+		return pkg + "." + t.Name
+	case *ast.BinaryExpr:
+		return arrayLen(t.X, pkg) + " " + t.Op.String() + " " + arrayLen(t.Y, pkg)
+	case *ast.ParenExpr:
+		return "(" + arrayLen(t.X, pkg) + ")"
+	}
+	return types.ExprString(expr)
+}
+
+func isTypeParam(name string, typeParams []string) bool {
+	for _, tp := range typeParams {
+		if name == tp {
+			return true
+		}
+	}
+	return false
+}
+
+// isConstraintInterface reports whether the interface declares a type set
+// (i.e. ~int | ~float64) and can therefore only be used as a constraint.
+func isConstraintInterface(iface *ast.InterfaceType) bool {
+	for _, member := range iface.Methods.List {
+		if len(member.Names) != 0 {
+			continue
+		}
+		switch t := member.Type.(type) {
+		case *ast.BinaryExpr, *ast.UnaryExpr:
+			return true
+		case *ast.Ident:
+			if IsPrimitive(t.Name) && t.Name != "error" && t.Name != "any" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func paramFromMember(param *ast.Field, packageName string, typeParams []string) []Param {
 	ps := []Param{}
 
 	for _, name := range param.Names {
 		p := Param{}
-		inner := typeFromField(param.Type, packageName, true)
+		inner := typeFromField(param.Type, packageName, true, typeParams)
 		if inner.Success {
 			p.Name = name.Name
 			p.Type = inner.Type
@@ -221,7 +523,7 @@ func paramFromMember(param *ast.Field, packageName string) []Param {
 
 	if len(param.Names) == 0 {
 		p := Param{}
-		inner := typeFromField(param.Type, packageName, true)
+		inner := typeFromField(param.Type, packageName, true, typeParams)
 		if inner.Success {
 			p.Type = inner.Type
 			p.Kind = inner.Kind
@@ -232,87 +534,232 @@ func paramFromMember(param *ast.Field, packageName string) []Param {
 	return ps
 }
 
-func buildMock(i Interface) string {
+// synthesizeParamNames names the params the source left unnamed, so generated code can
+// declare and forward them: ctx for a context, id for the key of a ByID method and p<n>
+// for anything else.
+func synthesizeParamNames(m Method) Method {
+	taken := map[string]bool{}
+	for _, p := range m.Params {
+		taken[p.Name] = true
+	}
+
+	params := []Param{}
+	for idx, p := range m.Params {
+		if p.Name == "" {
+			name := fmt.Sprintf("p%d", idx)
+			if p.Type == "context.Context" && !taken["ctx"] {
+				name = "ctx"
+			} else if strings.Contains(m.Name, "ByID") && !taken["id"] {
+				name = "id"
+			}
+			p.Name = name
+			taken[name] = true
+		}
+		params = append(params, p)
+	}
+	m.Params = params
+	return m
+}
+
+func buildMock(i Interface, opts MockOptions) string {
 	callbackSuffix := "Callback"
-	mockName := "Mock" + i.Name
+	mockName := mockNameFor(i)
+	receiverName := mockName + typeParamNames(i.TypeParams) // MockRepo[T]
+
+	for idx, m := range i.Methods {
+		i.Methods[idx] = namedResults(namedParams(m, mockReservedNames), mockResultNames)
+	}
+
+	callDefs := []string{}
+	for _, m := range i.Methods {
+		callDefs = append(callDefs, buildCallStruct(i, m))
+	}
+	callDef := strings.Join(callDefs, "\n")
 
-	structDef := buildStruct(i, mockName, callbackSuffix)
+	structDef := buildStruct(i, mockName, callbackSuffix, opts)
 	methodDefs := []string{}
 	for _, m := range i.Methods {
-		methodDef := buildMethod(m, mockName, callbackSuffix)
+		methodDef := buildMethod(i, m, receiverName, callbackSuffix, opts)
 		methodDefs = append(methodDefs, methodDef)
 	}
 
 	methodDef := strings.Join(methodDefs, "\n")
-	resetDef := buildResetMethod(i, mockName, callbackSuffix)
-
-	mockDef := fmt.Sprintf("%s\n\n%s\n%s", structDef, methodDef, resetDef)
+	callHelperDefs := []string{}
+	for _, m := range i.Methods {
+		callHelperDefs = append(callHelperDefs, buildCallHelpers(i, m, receiverName))
+	}
+	callHelperDef := strings.Join(callHelperDefs, "\n")
+	syncDef := buildSyncHelpers(i, receiverName, callbackSuffix)
+	returnsDefs := []string{}
+	for _, m := range i.Methods {
+		if len(m.Returns) > 0 {
+			returnsDefs = append(returnsDefs, buildReturns(i, m, receiverName))
+		}
+	}
+	returnsDef := strings.Join(returnsDefs, "\n")
+	resetDef := buildResetMethod(i, receiverName, callbackSuffix, opts)
+
+	mockDef := fmt.Sprintf("%s\n%s\n\n%s\n%s\n%s\n%s\n%s", callDef, structDef, methodDef, returnsDef, callHelperDef, syncDef, resetDef)
+	if opts.Strict {
+		expectationDefs := []string{}
+		for _, m := range i.Methods {
+			expectationDefs = append(expectationDefs, buildExpectation(i, m, receiverName))
+		}
+		strictDef := buildStrictSupport(i, mockName, receiverName)
+		mockDef = fmt.Sprintf("%s\n%s\n%s", mockDef, strictDef, strings.Join(expectationDefs, "\n"))
+	}
 	return mockDef
 }
 
-func buildStruct(i Interface, mockName string, callbackSuffix string) string {
-	structString := fmt.Sprintf("type %s struct {\n", mockName)
+func buildStruct(i Interface, mockName string, callbackSuffix string, opts MockOptions) string {
+	structString := fmt.Sprintf("type %s%s struct {\n", mockName, typeParamDecl(i.TypeParams))
+	structString = fmt.Sprintf("%s\t// use the Set<Method>Callback methods to change callbacks while the mock is being called\n", structString)
+	for _, m := range i.Methods {
+		structString = fmt.Sprintf("%s\t%s%s %s\n", structString, m.Name, callbackSuffix, callbackTypeFor(m))
+	}
+	structString = fmt.Sprintf("%s\n\tCalls struct {\n", structString)
 	for _, m := range i.Methods {
-		paramString := []string{}
-		returnString := []string{}
-		for _, p := range m.Params {
-			paramString = append(paramString, p.Name+" "+p.Type)
+		structString = fmt.Sprintf("%s\t\t%s []%s\n", structString, m.Name, callTypeFor(i, m))
+	}
+	structString = fmt.Sprintf("%s\t}\n\n\treturns struct {\n", structString)
+	for _, m := range i.Methods {
+		if len(m.Returns) > 0 {
+			structString = fmt.Sprintf("%s\t\t%s *%s\n", structString, m.Name, returnsTypeFor(i, m))
 		}
-		params := strings.Join(paramString, ", ")
-
-		for _, r := range m.Returns {
-			returnString = append(returnString, r.Type)
+	}
+	structString = fmt.Sprintf("%s\t}\n\tmu     sync.Mutex\n\tnotify chan struct{}\n", structString)
+	if opts.Strict {
+		structString = fmt.Sprintf("%s\n\tt        testing.TB\n\tinOrder  bool\n\texpected []%s\n", structString, expectationInterfaceFor(i))
+		structString = fmt.Sprintf("%s\texpectations struct {\n", structString)
+		for _, m := range i.Methods {
+			structString = fmt.Sprintf("%s\t\t%s []*%s\n", structString, m.Name, expectationTypeFor(i, m))
 		}
-		returns := strings.Join(returnString, ", ")
-
-		method := fmt.Sprintf("%s%s func(%s) (%s)", m.Name, callbackSuffix, params, returns)
-		structString = fmt.Sprintf("%s\t%s\n", structString, method)
+		structString = fmt.Sprintf("%s\t}\n", structString)
 	}
 	structString = fmt.Sprintf("%s}", structString)
 	return structString
 }
 
-func buildResetMethod(i Interface, mockName string, callbackSuffix string) string {
+// resultList writes the results of a signature: nothing, a lone type or a parenthesized
+// list. Names are kept when named is set and the results have them.
+func resultList(returns []Param, named bool) string {
+	if len(returns) == 0 {
+		return ""
+	}
+	named = named && returns[0].Name != ""
+
+	results := []string{}
+	for _, r := range returns {
+		if named {
+			results = append(results, r.Name+" "+r.Type)
+		} else {
+			results = append(results, r.Type)
+		}
+	}
+	if len(results) == 1 && !named {
+		return " " + results[0]
+	}
+	return " (" + strings.Join(results, ", ") + ")"
+}
+
+// typeParamDecl renders type parameters as they appear in a type declaration i.e. [K comparable, V any]
+func typeParamDecl(typeParams []Param) string {
+	if len(typeParams) == 0 {
+		return ""
+	}
+	decls := []string{}
+	for _, tp := range typeParams {
+		decls = append(decls, tp.Name+" "+tp.Type)
+	}
+	return "[" + strings.Join(decls, ", ") + "]"
+}
+
+// typeParamNames renders type parameters as they appear in a receiver i.e. [K, V]
+func typeParamNames(typeParams []Param) string {
+	if len(typeParams) == 0 {
+		return ""
+	}
+	names := []string{}
+	for _, tp := range typeParams {
+		names = append(names, tp.Name)
+	}
+	return "[" + strings.Join(names, ", ") + "]"
+}
+
+func buildResetMethod(i Interface, mockName string, callbackSuffix string, opts MockOptions) string {
 	method := fmt.Sprintf("func (m *%s) ResetMock() {\n", mockName)
+	method = fmt.Sprintf("%s\tm.mu.Lock()\n\tdefer m.mu.Unlock()\n\n", method)
 	for _, m := range i.Methods {
 		method = fmt.Sprintf("%s\tm.%s%s = nil\n", method, m.Name, callbackSuffix)
 	}
+	for _, m := range i.Methods {
+		method = fmt.Sprintf("%s\tm.Calls.%s = nil\n", method, m.Name)
+		if len(m.Returns) > 0 {
+			method = fmt.Sprintf("%s\tm.returns.%s = nil\n", method, m.Name)
+		}
+	}
+	if opts.Strict {
+		method = fmt.Sprintf("%s\tm.expected = nil\n", method)
+		for _, m := range i.Methods {
+			method = fmt.Sprintf("%s\tm.expectations.%s = nil\n", method, m.Name)
+		}
+	}
 	method = fmt.Sprintf("%s}\n", method)
 	return method
 }
 
-func buildMethod(m Method, mockName string, callbackSuffix string) string {
+func buildMethod(i Interface, m Method, mockName string, callbackSuffix string, opts MockOptions) string {
 	paramString := []string{}
-	returnString := []string{}
 	callString := []string{}
 	for _, p := range m.Params {
 		paramString = append(paramString, p.Name+" "+p.Type)
-		callString = append(callString, p.Name)
+		if p.Kind == Variadic {
+			callString = append(callString, p.Name+"...")
+		} else {
+			callString = append(callString, p.Name)
+		}
 	}
 	calls := strings.Join(callString, ", ")
 	params := strings.Join(paramString, ", ")
 
-	returnsString := []string{}
+	// results are named, so falling through returns their zero values whatever their type
+	returnNames := []string{}
 	for _, r := range m.Returns {
-		returnString = append(returnString, r.Type)
-
-		ret := ZeroValueFor(r.Kind, r.Type)
+		returnNames = append(returnNames, r.Name)
+	}
 
-		returnsString = append(returnsString, ret)
+	method := docComment(m.Doc, "")
+	method = fmt.Sprintf("%sfunc (m *%s) %s(%s)%s {\n", method, mockName, m.Name, params, resultList(m.Returns, true))
+	method = fmt.Sprintf("%s\tcall := %s\n", method, callLiteral(i, m))
+	method = fmt.Sprintf("%s\tm.mu.Lock()\n", method)
+	method = fmt.Sprintf("%s\tm.Calls.%s = append(m.Calls.%s, call)\n", method, m.Name, m.Name)
+	method = fmt.Sprintf("%s\tcallback := m.%s%s\n", method, m.Name, callbackSuffix)
+	method = fmt.Sprintf("%s\tm.notifyCall()\n", method)
+	method = fmt.Sprintf("%s\tm.mu.Unlock()\n\n", method)
+
+	if opts.Strict {
+		method = fmt.Sprintf("%s\tif e := m.expected%s(call); e != nil {\n", method, m.Name)
+		method = fmt.Sprintf("%s\t\treturn %s\n\t}\n", method, strings.Join(expectationReturns(m), ", "))
 	}
-	returns := strings.Join(returnString, ", ")
-	returnCalls := strings.Join(returnsString, ", ")
 
-	method := fmt.Sprintf("func (m *%s) %s(%s) (%s) {\n", mockName, m.Name, params, returns)
-	method = fmt.Sprintf("%s\tif m.%s%s != nil {\n", method, m.Name, callbackSuffix)
+	method = fmt.Sprintf("%s\tif callback != nil {\n", method)
 
 	if len(m.Returns) == 0 { //if function doesn't return anything, so just call it
-		method = fmt.Sprintf("%s\t\tm.%s%s(%s)\n\t}\n", method, m.Name, callbackSuffix, calls)
+		method = fmt.Sprintf("%s\t\tcallback(%s)\n\t\treturn\n\t}\n", method, calls)
 	} else {
-		method = fmt.Sprintf("%s\t\treturn m.%s%s(%s)\n\t}\n", method, m.Name, callbackSuffix, calls)
+		method = fmt.Sprintf("%s\t\treturn callback(%s)\n\t}\n", method, calls)
+		method = fmt.Sprintf("%s\tif r, ok := m.next%sResult(); ok {\n", method, m.Name)
+		method = fmt.Sprintf("%s\t\treturn %s\n\t}\n", method, strings.Join(resultFields(m, "r."), ", "))
+	}
+
+	if opts.Strict {
+		method = fmt.Sprintf("%s\tif m.t != nil {\n\t\tm.t.Fatalf(\"unexpected call to %s with %%+v\", call)\n\t}\n", method, m.Name)
 	}
 
-	method = fmt.Sprintf("%s\treturn %s\n}\n", method, returnCalls)
+	if len(m.Returns) > 0 {
+		method = fmt.Sprintf("%s\treturn %s\n", method, strings.Join(returnNames, ", "))
+	}
+	method = fmt.Sprintf("%s}\n", method)
 
 	return method
 }
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// mockReservedNames are identifiers the generated mock methods declare themselves.
+var mockReservedNames = []string{"m", "t", "e", "want", "call", "calls", "callback"}
+
+// mockResultNames are also declared by the queued result check, so results can't use them.
+var mockResultNames = append([]string{"r", "ok"}, mockReservedNames...)
+
+// namedParams names any unnamed or blank params so generated code can refer to them,
+// renaming those that clash with the reserved names the generated method declares itself.
+func namedParams(m Method, reservedNames []string) Method {
+	params := []Param{}
+	for idx, p := range m.Params {
+		if p.Name == "" || p.Name == "_" {
+			p.Name = fmt.Sprintf("arg%d", idx)
+		}
+		for _, reserved := range reservedNames {
+			if p.Name == reserved {
+				p.Name = p.Name + "Arg"
+			}
+		}
+		params = append(params, p)
+	}
+	m.Params = params
+	return m
+}
+
+// namedResults names the results of m, so generated code can refer to them. Source names
+// are kept unless they are blank or clash with a param or one of the reserved names.
+func namedResults(m Method, reservedNames []string) Method {
+	taken := map[string]bool{}
+	for _, p := range m.Params {
+		taken[p.Name] = true
+	}
+	for _, reserved := range reservedNames {
+		taken[reserved] = true
+	}
+
+	returns := []Param{}
+	for idx, r := range m.Returns {
+		if r.Name == "" || r.Name == "_" || taken[r.Name] {
+			r.Name = fmt.Sprintf("r%d", idx)
+		}
+		taken[r.Name] = true
+		returns = append(returns, r)
+	}
+	m.Returns = returns
+	return m
+}
+
+// callTypeFor is the type recording the arguments of a call to m i.e. MockRepoGetUserCall[T]
+func callTypeFor(i Interface, m Method) string {
+	return mockNameFor(i) + m.Name + "Call" + typeParamNames(i.TypeParams)
+}
+
+// callFieldName exports a param name so it can be a field of the call struct.
+func callFieldName(p Param) string {
+	runes := []rune(p.Name)
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
+
+// callFieldType is the type a param is recorded as. Variadic params are stored as slices.
+func callFieldType(p Param) string {
+	if p.Kind == Variadic {
+		return "[]" + strings.TrimPrefix(p.Type, "...")
+	}
+	return p.Type
+}
+
+func buildCallStruct(i Interface, m Method) string {
+	callName := mockNameFor(i) + m.Name + "Call"
+	callStruct := fmt.Sprintf("// %s holds the arguments of a call to %s.\n", callName, m.Name)
+	callStruct = fmt.Sprintf("%stype %s%s struct {\n", callStruct, callName, typeParamDecl(i.TypeParams))
+	for _, p := range m.Params {
+		callStruct = fmt.Sprintf("%s\t%s %s\n", callStruct, callFieldName(p), callFieldType(p))
+	}
+	callStruct = fmt.Sprintf("%s}\n", callStruct)
+	return callStruct
+}
+
+// callLiteral builds the call struct from the params of the mocked method.
+func callLiteral(i Interface, m Method) string {
+	fields := []string{}
+	for _, p := range m.Params {
+		fields = append(fields, fmt.Sprintf("%s: %s", callFieldName(p), p.Name))
+	}
+	return fmt.Sprintf("%s{%s}", callTypeFor(i, m), strings.Join(fields, ", "))
+}
+
+func buildCallHelpers(i Interface, m Method, mockName string) string {
+	callType := callTypeFor(i, m)
+
+	helpers := fmt.Sprintf("// %sCallCount returns how many times %s was called.\n", m.Name, m.Name)
+	helpers = fmt.Sprintf("%sfunc (m *%s) %sCallCount() int {\n", helpers, mockName, m.Name)
+	helpers = fmt.Sprintf("%s\tm.mu.Lock()\n\tdefer m.mu.Unlock()\n", helpers)
+	helpers = fmt.Sprintf("%s\treturn len(m.Calls.%s)\n}\n\n", helpers, m.Name)
+
+	helpers = fmt.Sprintf("%s// %sCalls returns a copy of the arguments of every call to %s.\n", helpers, m.Name, m.Name)
+	helpers = fmt.Sprintf("%sfunc (m *%s) %sCalls() []%s {\n", helpers, mockName, m.Name, callType)
+	helpers = fmt.Sprintf("%s\tm.mu.Lock()\n\tdefer m.mu.Unlock()\n", helpers)
+	helpers = fmt.Sprintf("%s\treturn append([]%s(nil), m.Calls.%s...)\n}\n\n", helpers, callType, m.Name)
+
+	helpers = fmt.Sprintf("%s// Assert%sCalled fails the test unless %s was called exactly n times.\n", helpers, m.Name, m.Name)
+	helpers = fmt.Sprintf("%sfunc (m *%s) Assert%sCalled(t testing.TB, n int) {\n", helpers, mockName, m.Name)
+	helpers = fmt.Sprintf("%s\tt.Helper()\n", helpers)
+	helpers = fmt.Sprintf("%s\tif count := m.%sCallCount(); count != n {\n", helpers, m.Name)
+	helpers = fmt.Sprintf("%s\t\tt.Errorf(\"expected %s to be called %%d times, was called %%d times\", n, count)\n\t}\n}\n\n", helpers, m.Name)
+
+	paramString := []string{}
+	for _, p := range m.Params {
+		paramString = append(paramString, p.Name+" "+p.Type)
+	}
+	params := strings.Join(append([]string{"t testing.TB"}, paramString...), ", ")
+
+	helpers = fmt.Sprintf("%s// Assert%sCalledWith fails the test unless %s was called with the given arguments.\n", helpers, m.Name, m.Name)
+	helpers = fmt.Sprintf("%sfunc (m *%s) Assert%sCalledWith(%s) {\n", helpers, mockName, m.Name, params)
+	helpers = fmt.Sprintf("%s\tt.Helper()\n", helpers)
+	helpers = fmt.Sprintf("%s\twant := %s\n", helpers, callLiteral(i, m))
+	helpers = fmt.Sprintf("%s\tcalls := m.%sCalls()\n", helpers, m.Name)
+	helpers = fmt.Sprintf("%s\tfor _, call := range calls {\n", helpers)
+	helpers = fmt.Sprintf("%s\t\tif reflect.DeepEqual(call, want) {\n\t\t\treturn\n\t\t}\n\t}\n", helpers)
+	helpers = fmt.Sprintf("%s\tt.Errorf(\"expected %s to be called with %%+v, got %%+v\", want, calls)\n}\n", helpers, m.Name)
+
+	return helpers
+}
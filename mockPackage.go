@@ -0,0 +1,315 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// makePackageMocks type checks every file of the package in dir and writes mocks for its
+// exported interfaces, or only the interfaces named in selected.
+func makePackageMocks(dir string, outFile string, selected []string, opts MockOptions) error {
+	pkg, docs, err := loadPackage(dir)
+	if err != nil {
+		return err
+	}
+
+	imports := newImportSet()
+	outputPath := ""
+	packageName := opts.outputPackage(outFile)
+	if sameDir(filepath.Join(dir, "x.go"), outFile) {
+		outputPath = pkg.Path()
+		packageName = pkg.Name()
+	}
+
+	allMocks := fmt.Sprintf("// Generated by Rawdog\n\npackage %s\n", packageName)
+	for _, i := range packageInterfaces(pkg, selected, imports.qualifier(outputPath), docs) {
+		allMocks = fmt.Sprintf("%s\n\n%s", allMocks, buildMock(i, opts))
+	}
+
+	return writeGoFile(outFile, allMocks, imports)
+}
+
+// makeExternalMocks writes mocks for interfaces of any importable package, named by import
+// path and interface i.e. net/http.RoundTripper. Packages are resolved from source in GOROOT,
+// GOPATH or the module cache of the current module, with the limits of loadPackage.
+func makeExternalMocks(names []string, outFile string, opts MockOptions) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	imports := newImportSet()
+	outputPath, _ := dirImportPath(filepath.Dir(outFile))
+	qualifier := imports.qualifier(outputPath)
+	imp := importer.ForCompiler(token.NewFileSet(), "source", nil).(types.ImporterFrom)
+
+	interfaces := []Interface{}
+	for _, name := range names {
+		dot := strings.LastIndex(name, ".")
+		if dot <= strings.LastIndex(name, "/") {
+			return fmt.Errorf("%s is not of the form <import path>.<interface>", name)
+		}
+		importPath, ifaceName := name[:dot], name[dot+1:]
+
+		pkg, err := imp.ImportFrom(importPath, wd, 0)
+		if err != nil {
+			return err
+		}
+		typeName, success := pkg.Scope().Lookup(ifaceName).(*types.TypeName)
+		if !success {
+			return fmt.Errorf("%s has no type %s", importPath, ifaceName)
+		}
+		i, success := interfaceFromTypes(typeName, qualifier, nil)
+		if !success {
+			return fmt.Errorf("%s is not an interface with methods", name)
+		}
+		interfaces = append(interfaces, i)
+	}
+	if err := nameClashingMocks(interfaces); err != nil {
+		return err
+	}
+
+	allMocks := fmt.Sprintf("// Generated by Rawdog\n\npackage %s\n", opts.outputPackage(outFile))
+	for _, i := range interfaces {
+		allMocks = fmt.Sprintf("%s\n\n%s", allMocks, buildMock(i, opts))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outFile), 0755); err != nil {
+		return err
+	}
+	return writeGoFile(outFile, allMocks, imports)
+}
+
+// nameClashingMocks puts the package in the names of the mocks of interfaces with the same name
+// i.e. MockDriverConn and MockNetConn for database/sql/driver.Conn and net.Conn
+func nameClashingMocks(interfaces []Interface) error {
+	count := map[string]int{}
+	for _, i := range interfaces {
+		count[i.Name]++
+	}
+	mockNames := map[string]bool{}
+	for idx, i := range interfaces {
+		if count[i.Name] > 1 {
+			interfaces[idx].MockName = "Mock" + strings.ToUpper(i.Package[:1]) + i.Package[1:] + i.Name
+		}
+		mockName := mockNameFor(interfaces[idx])
+		if mockNames[mockName] {
+			return fmt.Errorf("the mocks of two interfaces would be called %s, mock them into different files", mockName)
+		}
+		mockNames[mockName] = true
+	}
+	return nil
+}
+
+// outputPackage is the package clause of a generated file, unless one was asked for.
+func (opts MockOptions) outputPackage(output string) string {
+	if opts.Package != "" {
+		return opts.Package
+	}
+	return outputPackage(output)
+}
+
+// methodDocs are the doc comments of interface methods and of methods declared on types, by
+// the position of the method name.
+type methodDocs map[token.Pos]*ast.CommentGroup
+
+// loadPackage parses and type checks the package in dir, resolving its imports from source,
+// and collects the doc comments of the methods it declares. The package is returned along
+// with the first type error, if it could be checked at all.
+//
+// Files are picked by go/build for the default build context, -tags aren't taken, and the
+// source importer doesn't follow the replace directives of a go.mod, unlike go/packages. Both
+// are left to the standard library so rawdog keeps building without dependencies.
+func loadPackage(dir string) (*types.Package, methodDocs, error) {
+	bp, err := build.ImportDir(dir, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fset := token.NewFileSet()
+	files := []*ast.File{}
+	for _, name := range bp.GoFiles {
+		f, err := parser.ParseFile(fset, filepath.Join(bp.Dir, name), nil, parser.ParseComments)
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, f)
+	}
+
+	docs := methodDocs{}
+	for _, f := range files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			if funcDecl, success := n.(*ast.FuncDecl); success {
+				docs[funcDecl.Name.Pos()] = funcDecl.Doc
+				return false
+			}
+			iface, success := n.(*ast.InterfaceType)
+			if !success {
+				return true
+			}
+			for _, member := range iface.Methods.List {
+				for _, name := range member.Names {
+					docs[name.Pos()] = member.Doc
+				}
+			}
+			return true
+		})
+	}
+
+	importPath, success := dirImportPath(bp.Dir)
+	if !success {
+		importPath = bp.Name
+	}
+	// checking goes on past the first error, so the package comes back along with it for
+	// callers that can do with what did type check
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil), Error: func(error) {}}
+	pkg, err := conf.Check(importPath, fset, files, nil)
+	return pkg, docs, err
+}
+
+// dirImportPath finds the real import path of the package in dir, asking the go command when
+// the package lives in a module rather than on the GOPATH.
+func dirImportPath(dir string) (string, bool) {
+	bp, err := build.ImportDir(dir, build.FindOnly)
+	if err == nil && bp.ImportPath != "" && bp.ImportPath != "." {
+		return bp.ImportPath, true
+	}
+	out, err := exec.Command("go", "list", "-f", "{{.ImportPath}}", mustAbs(dir)).Output()
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(out)), true
+}
+
+// packageInterfaces builds an Interface for every exported, mockable interface in the package,
+// or only for those named in selected.
+func packageInterfaces(pkg *types.Package, selected []string, qualifier types.Qualifier, docs methodDocs) []Interface {
+	interfaces := []Interface{}
+	for _, name := range pkg.Scope().Names() {
+		if len(selected) > 0 && !isSelected(name, selected) {
+			continue
+		}
+		typeName, success := pkg.Scope().Lookup(name).(*types.TypeName)
+		if !success || !typeName.Exported() {
+			continue
+		}
+		i, success := interfaceFromTypes(typeName, qualifier, docs)
+		if success {
+			interfaces = append(interfaces, i)
+		}
+	}
+	for _, name := range selected {
+		if pkg.Scope().Lookup(name) == nil {
+			fmt.Printf("WARNING: %s has no interface %s\n", pkg.Path(), name)
+		}
+	}
+	return interfaces
+}
+
+func isSelected(name string, selected []string) bool {
+	for _, s := range selected {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// interfaceFromTypes builds an Interface from a type checked declaration. Embedded interfaces
+// are already flattened into its method set. docs may be nil when the source wasn't parsed.
+func interfaceFromTypes(typeName *types.TypeName, qualifier types.Qualifier, docs methodDocs) (Interface, bool) {
+	i := Interface{}
+	iface, success := typeName.Type().Underlying().(*types.Interface)
+	if !success || !iface.IsMethodSet() || iface.NumMethods() == 0 {
+		return i, false
+	}
+
+	if named, success := typeName.Type().(*types.Named); success {
+		typeParams := named.TypeParams()
+		for idx := 0; idx < typeParams.Len(); idx++ {
+			tp := typeParams.At(idx)
+			i.TypeParams = append(i.TypeParams, Param{Name: tp.Obj().Name(), Type: types.TypeString(tp.Constraint(), qualifier), Kind: TypeParam})
+		}
+	}
+
+	for idx := 0; idx < iface.NumMethods(); idx++ {
+		i.Methods = append(i.Methods, methodFromTypes(iface.Method(idx), qualifier, docs))
+	}
+
+	i.Name = typeName.Name()
+	i.Package = typeName.Pkg().Name()
+	return i, true
+}
+
+// methodFromTypes builds a Method from a type checked method. docs may be nil.
+func methodFromTypes(fn *types.Func, qualifier types.Qualifier, docs methodDocs) Method {
+	sig := fn.Type().(*types.Signature)
+	meth := Method{Name: fn.Name(), Doc: docLines(docs[fn.Pos()]), Directives: directives(docs[fn.Pos()])}
+	for p := 0; p < sig.Params().Len(); p++ {
+		variadic := sig.Variadic() && p == sig.Params().Len()-1
+		meth.Params = append(meth.Params, paramFromVar(sig.Params().At(p), variadic, qualifier))
+	}
+	for r := 0; r < sig.Results().Len(); r++ {
+		meth.Returns = append(meth.Returns, paramFromVar(sig.Results().At(r), false, qualifier))
+	}
+	return synthesizeParamNames(meth)
+}
+
+func paramFromVar(v *types.Var, variadic bool, qualifier types.Qualifier) Param {
+	p := Param{Name: v.Name()}
+	if variadic { // the last param of a variadic signature is typed as a slice
+		p.Type = "..." + types.TypeString(v.Type().(*types.Slice).Elem(), qualifier)
+		p.Kind = Variadic
+		return p
+	}
+	p.Type = types.TypeString(v.Type(), qualifier)
+	p.Kind = kindFromType(v.Type())
+	return p
+}
+
+// kindFromType finds the VariableKind ZeroValueFor needs to write the zero value of t.
+func kindFromType(t types.Type) VariableKind {
+	switch u := types.Unalias(t).(type) {
+	case *types.TypeParam:
+		return TypeParam
+	case *types.Named:
+		switch u.Underlying().(type) {
+		case *types.Struct:
+			return Value // domain.User{}
+		case *types.Array:
+			return Array
+		case *types.Basic:
+			return NamedBasic // domain.Status
+		default:
+			return kindFromType(u.Underlying())
+		}
+	case *types.Basic:
+		return Value
+	case *types.Pointer:
+		return Pointer
+	case *types.Slice:
+		return Slice
+	case *types.Array:
+		return Array
+	case *types.Map:
+		return Map
+	case *types.Chan:
+		return Chan
+	case *types.Signature:
+		return Func
+	case *types.Struct:
+		return GoStruct
+	case *types.Interface:
+		return GoInterface
+	}
+	return Value
+}
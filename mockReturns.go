@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// returnsTypeFor is the queue of canned results for m i.e. MockRepoGetUserReturns[T]
+func returnsTypeFor(i Interface, m Method) string {
+	return mockNameFor(i) + m.Name + "Returns" + typeParamNames(i.TypeParams)
+}
+
+// resultTypeFor is a single canned result for m i.e. mockRepoGetUserResult[T]
+func resultTypeFor(i Interface, m Method) string {
+	runes := []rune(mockNameFor(i) + m.Name + "Result")
+	runes[0] = unicode.ToLower(runes[0])
+	return string(runes) + typeParamNames(i.TypeParams)
+}
+
+// resultFields are the fields of a canned result, in the order of m.Returns.
+func resultFields(m Method, prefix string) []string {
+	fields := []string{}
+	for idx := range m.Returns {
+		fields = append(fields, fmt.Sprintf("%sr%d", prefix, idx))
+	}
+	return fields
+}
+
+func buildReturns(i Interface, m Method, receiverName string) string {
+	returnsName := mockNameFor(i) + m.Name + "Returns"
+	returnsType := returnsTypeFor(i, m)
+	resultType := resultTypeFor(i, m)
+
+	returnParams := []string{}
+	for idx, r := range m.Returns {
+		returnParams = append(returnParams, fmt.Sprintf("r%d %s", idx, r.Type))
+	}
+	params := strings.Join(returnParams, ", ")
+	fields := resultFields(m, "")
+	result := fmt.Sprintf("%s{%s}", resultType, strings.Join(fields, ", "))
+
+	resultName := strings.TrimSuffix(resultType, typeParamNames(i.TypeParams))
+	ret := fmt.Sprintf("// %s is one queued result of %s.\n", resultName, m.Name)
+	ret = fmt.Sprintf("%stype %s%s struct {\n", ret, resultName, typeParamDecl(i.TypeParams))
+	for idx, r := range m.Returns {
+		ret = fmt.Sprintf("%s\tr%d %s\n", ret, idx, r.Type)
+	}
+	ret = fmt.Sprintf("%s}\n\n", ret)
+
+	ret = fmt.Sprintf("%s// %s is a queue of results for %s.\n", ret, returnsName, m.Name)
+	ret = fmt.Sprintf("%stype %s%s struct {\n", ret, returnsName, typeParamDecl(i.TypeParams))
+	ret = fmt.Sprintf("%s\tmock  *%s\n\tqueue []%s\n}\n\n", ret, receiverName, resultType)
+
+	ret = fmt.Sprintf("%s// %sReturns makes the next call to %s return the given values. Queue more\n", ret, m.Name, m.Name)
+	ret = fmt.Sprintf("%s// results with Then, the last one is repeated once the queue runs out.\n", ret)
+	ret = fmt.Sprintf("%sfunc (m *%s) %sReturns(%s) *%s {\n", ret, receiverName, m.Name, params, returnsType)
+	ret = fmt.Sprintf("%s\tm.mu.Lock()\n\tdefer m.mu.Unlock()\n", ret)
+	ret = fmt.Sprintf("%s\tm.returns.%s = &%s{mock: m, queue: []%s{%s}}\n", ret, m.Name, returnsType, resultType, result)
+	ret = fmt.Sprintf("%s\treturn m.returns.%s\n}\n\n", ret, m.Name)
+
+	ret = fmt.Sprintf("%s// Then queues the values returned by the call after the previous one.\n", ret)
+	ret = fmt.Sprintf("%sfunc (q *%s) Then(%s) *%s {\n", ret, returnsType, params, returnsType)
+	ret = fmt.Sprintf("%s\tq.mock.mu.Lock()\n\tdefer q.mock.mu.Unlock()\n", ret)
+	ret = fmt.Sprintf("%s\tq.queue = append(q.queue, %s)\n", ret, result)
+	ret = fmt.Sprintf("%s\treturn q\n}\n\n", ret)
+
+	ret = fmt.Sprintf("%s// next%sResult pops the next queued result for %s, if any.\n", ret, m.Name, m.Name)
+	ret = fmt.Sprintf("%sfunc (m *%s) next%sResult() (%s, bool) {\n", ret, receiverName, m.Name, resultType)
+	ret = fmt.Sprintf("%s\tm.mu.Lock()\n\tdefer m.mu.Unlock()\n", ret)
+	ret = fmt.Sprintf("%s\tq := m.returns.%s\n", ret, m.Name)
+	ret = fmt.Sprintf("%s\tif q == nil || len(q.queue) == 0 {\n\t\treturn %s{}, false\n\t}\n", ret, resultType)
+	ret = fmt.Sprintf("%s\tr := q.queue[0]\n", ret)
+	ret = fmt.Sprintf("%s\tif len(q.queue) > 1 {\n\t\tq.queue = q.queue[1:]\n\t}\n", ret)
+	ret = fmt.Sprintf("%s\treturn r, true\n}\n", ret)
+
+	return ret
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// expectationTypeFor is the type describing an expected call to m i.e. MockRepoGetUserExpectation[T]
+func expectationTypeFor(i Interface, m Method) string {
+	return mockNameFor(i) + m.Name + "Expectation" + typeParamNames(i.TypeParams)
+}
+
+// expectationInterfaceFor is the unexported interface every expectation of the mock satisfies.
+func expectationInterfaceFor(i Interface) string {
+	runes := []rune(mockNameFor(i) + "Expectation")
+	runes[0] = unicode.ToLower(runes[0])
+	return string(runes)
+}
+
+// expectationReturns are the values an expectation returns, in the order of m.Returns.
+func expectationReturns(m Method) []string {
+	returns := []string{}
+	for idx := range m.Returns {
+		returns = append(returns, fmt.Sprintf("e.r%d", idx))
+	}
+	return returns
+}
+
+func buildStrictSupport(i Interface, mockName string, receiverName string) string {
+	expectation := expectationInterfaceFor(i)
+
+	support := fmt.Sprintf("// %s is an expected call to any method of %s.\n", expectation, mockName)
+	support = fmt.Sprintf("%stype %s interface {\n\tmet() bool\n\tString() string\n}\n\n", support, expectation)
+
+	support = fmt.Sprintf("%s// New%s returns a strict mock. Calls that were neither expected nor\n", support, mockName)
+	support = fmt.Sprintf("%s// given a callback fail the test, as do expectations that were not met.\n", support)
+	support = fmt.Sprintf("%sfunc New%s%s(t testing.TB) *%s {\n", support, mockName, typeParamDecl(i.TypeParams), receiverName)
+	support = fmt.Sprintf("%s\tm := &%s{t: t}\n", support, receiverName)
+	support = fmt.Sprintf("%s\tt.Cleanup(func() { m.AssertExpectations(t) })\n", support)
+	support = fmt.Sprintf("%s\treturn m\n}\n\n", support)
+
+	support = fmt.Sprintf("%s// InOrder makes the mock fail the test when expected calls happen out of the order they were declared in.\n", support)
+	support = fmt.Sprintf("%s// Only a mock made by New%s has a test to fail.\n", support, mockName)
+	support = fmt.Sprintf("%sfunc (m *%s) InOrder() *%s {\n", support, receiverName, receiverName)
+	support = fmt.Sprintf("%s\tm.mu.Lock()\n\tdefer m.mu.Unlock()\n", support)
+	support = fmt.Sprintf("%s\tm.inOrder = true\n\treturn m\n}\n\n", support)
+
+	support = fmt.Sprintf("%s// AssertExpectations fails the test for every expected call that did not happen.\n", support)
+	support = fmt.Sprintf("%s// It runs automatically when the test passed to New%s finishes, a mock declared as a struct\n// literal has to call it itself.\n", support, mockName)
+	support = fmt.Sprintf("%sfunc (m *%s) AssertExpectations(t testing.TB) {\n", support, receiverName)
+	support = fmt.Sprintf("%s\tt.Helper()\n", support)
+	support = fmt.Sprintf("%s\tm.mu.Lock()\n\tdefer m.mu.Unlock()\n", support)
+	support = fmt.Sprintf("%s\tfor _, e := range m.expected {\n", support)
+	support = fmt.Sprintf("%s\t\tif !e.met() {\n\t\t\tt.Errorf(\"missing call: %%v\", e)\n\t\t}\n\t}\n}\n", support)
+
+	return support
+}
+
+func buildExpectation(i Interface, m Method, receiverName string) string {
+	expectationName := mockNameFor(i) + m.Name + "Expectation"
+	expectationType := expectationTypeFor(i, m)
+
+	exp := fmt.Sprintf("// %s is an expected call to %s.\n", expectationName, m.Name)
+	exp = fmt.Sprintf("%stype %s%s struct {\n", exp, expectationName, typeParamDecl(i.TypeParams))
+	exp = fmt.Sprintf("%s\targs  %s\n", exp, callTypeFor(i, m))
+	exp = fmt.Sprintf("%s\ttimes int\n\tcalls int\n\tseq   int\n", exp)
+	for idx, r := range m.Returns {
+		exp = fmt.Sprintf("%s\tr%d    %s\n", exp, idx, r.Type)
+	}
+	exp = fmt.Sprintf("%s}\n\n", exp)
+
+	paramString := []string{}
+	for _, p := range m.Params {
+		paramString = append(paramString, p.Name+" "+p.Type)
+	}
+	params := strings.Join(paramString, ", ")
+
+	exp = fmt.Sprintf("%s// Expect%s expects one call to %s with the given arguments.\n", exp, m.Name, m.Name)
+	exp = fmt.Sprintf("%sfunc (m *%s) Expect%s(%s) *%s {\n", exp, receiverName, m.Name, params, expectationType)
+	exp = fmt.Sprintf("%s\tm.mu.Lock()\n\tdefer m.mu.Unlock()\n", exp)
+	exp = fmt.Sprintf("%s\te := &%s{args: %s, times: 1, seq: len(m.expected)}\n", exp, expectationType, callLiteral(i, m))
+	exp = fmt.Sprintf("%s\tm.expected = append(m.expected, e)\n", exp)
+	exp = fmt.Sprintf("%s\tm.expectations.%s = append(m.expectations.%s, e)\n", exp, m.Name, m.Name)
+	exp = fmt.Sprintf("%s\treturn e\n}\n\n", exp)
+
+	if len(m.Returns) > 0 {
+		returnParams := []string{}
+		returnAssigns := []string{}
+		for idx, r := range m.Returns {
+			returnParams = append(returnParams, fmt.Sprintf("r%d %s", idx, r.Type))
+			returnAssigns = append(returnAssigns, fmt.Sprintf("\te.r%d = r%d\n", idx, idx))
+		}
+		exp = fmt.Sprintf("%s// Return sets the values the expected call returns.\n", exp)
+		exp = fmt.Sprintf("%sfunc (e *%s) Return(%s) *%s {\n", exp, expectationType, strings.Join(returnParams, ", "), expectationType)
+		exp = fmt.Sprintf("%s%s\treturn e\n}\n\n", exp, strings.Join(returnAssigns, ""))
+	}
+
+	exp = fmt.Sprintf("%s// Times sets how many times the call is expected.\n", exp)
+	exp = fmt.Sprintf("%sfunc (e *%s) Times(n int) *%s {\n", exp, expectationType, expectationType)
+	exp = fmt.Sprintf("%s\te.times = n\n\treturn e\n}\n\n", exp)
+
+	exp = fmt.Sprintf("%sfunc (e *%s) met() bool {\n\treturn e.calls >= e.times\n}\n\n", exp, expectationType)
+
+	exp = fmt.Sprintf("%sfunc (e *%s) String() string {\n", exp, expectationType)
+	exp = fmt.Sprintf("%s\treturn fmt.Sprintf(\"%s(%%+v) expected %%d times, called %%d times\", e.args, e.times, e.calls)\n}\n\n", exp, m.Name)
+
+	exp = fmt.Sprintf("%s// expected%s finds the expectation a call to %s satisfies, if any.\n", exp, m.Name, m.Name)
+	exp = fmt.Sprintf("%sfunc (m *%s) expected%s(call %s) *%s {\n", exp, receiverName, m.Name, callTypeFor(i, m), expectationType)
+	exp = fmt.Sprintf("%s\tm.mu.Lock()\n\tdefer m.mu.Unlock()\n", exp)
+	exp = fmt.Sprintf("%s\tfor _, e := range m.expectations.%s {\n", exp, m.Name)
+	exp = fmt.Sprintf("%s\t\tif e.met() || !reflect.DeepEqual(e.args, call) {\n\t\t\tcontinue\n\t\t}\n", exp)
+	exp = fmt.Sprintf("%s\t\tif m.inOrder {\n", exp)
+	exp = fmt.Sprintf("%s\t\t\tfor _, prior := range m.expected[:e.seq] {\n", exp)
+	exp = fmt.Sprintf("%s\t\t\t\tif !prior.met() && m.t != nil {\n", exp)
+	exp = fmt.Sprintf("%s\t\t\t\t\tm.t.Fatalf(\"%s called out of order, still waiting for %%v\", prior)\n", exp, m.Name)
+	exp = fmt.Sprintf("%s\t\t\t\t}\n\t\t\t}\n\t\t}\n", exp)
+	exp = fmt.Sprintf("%s\t\te.calls++\n\t\treturn e\n\t}\n", exp)
+	exp = fmt.Sprintf("%s\treturn nil\n}\n", exp)
+
+	return exp
+}
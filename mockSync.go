@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// callbackTypeFor is the func type of the callback field for m.
+func callbackTypeFor(m Method) string {
+	paramString := []string{}
+	for _, p := range m.Params {
+		paramString = append(paramString, p.Name+" "+p.Type)
+	}
+	return fmt.Sprintf("func(%s)%s", strings.Join(paramString, ", "), resultList(m.Returns, false))
+}
+
+// buildSyncHelpers builds the callback setters and WaitForCalls, so mocks can be
+// reconfigured and waited on while other goroutines call them.
+func buildSyncHelpers(i Interface, mockName string, callbackSuffix string) string {
+	helpers := ""
+	for _, m := range i.Methods {
+		helpers = fmt.Sprintf("%s// Set%s%s replaces the callback for %s, safe to use while the mock is being called.\n", helpers, m.Name, callbackSuffix, m.Name)
+		helpers = fmt.Sprintf("%sfunc (m *%s) Set%s%s(callback %s) {\n", helpers, mockName, m.Name, callbackSuffix, callbackTypeFor(m))
+		helpers = fmt.Sprintf("%s\tm.mu.Lock()\n\tdefer m.mu.Unlock()\n", helpers)
+		helpers = fmt.Sprintf("%s\tm.%s%s = callback\n}\n\n", helpers, m.Name, callbackSuffix)
+	}
+
+	helpers = fmt.Sprintf("%s// WaitForCalls blocks until method has been called at least n times or the timeout\n", helpers)
+	helpers = fmt.Sprintf("%s// passes, and reports whether the calls happened. It returns false right away for a method\n// the mock doesn't have.\n", helpers)
+	helpers = fmt.Sprintf("%sfunc (m *%s) WaitForCalls(method string, n int, timeout time.Duration) bool {\n", helpers, mockName)
+	helpers = fmt.Sprintf("%s\tdeadline := time.After(timeout)\n", helpers)
+	helpers = fmt.Sprintf("%s\tfor {\n", helpers)
+	helpers = fmt.Sprintf("%s\t\tm.mu.Lock()\n", helpers)
+	helpers = fmt.Sprintf("%s\t\tcount, known := m.callCount(method)\n", helpers)
+	helpers = fmt.Sprintf("%s\t\tif m.notify == nil {\n\t\t\tm.notify = make(chan struct{})\n\t\t}\n", helpers)
+	helpers = fmt.Sprintf("%s\t\tnotify := m.notify\n", helpers)
+	helpers = fmt.Sprintf("%s\t\tm.mu.Unlock()\n\n", helpers)
+	helpers = fmt.Sprintf("%s\t\tif !known {\n\t\t\treturn false\n\t\t}\n", helpers)
+	helpers = fmt.Sprintf("%s\t\tif count >= n {\n\t\t\treturn true\n\t\t}\n", helpers)
+	helpers = fmt.Sprintf("%s\t\tselect {\n\t\tcase <-notify:\n\t\tcase <-deadline:\n\t\t\treturn false\n\t\t}\n\t}\n}\n\n", helpers)
+
+	helpers = fmt.Sprintf("%s// callCount returns how many times method was called, and whether the mock has the method.\n// The caller holds m.mu.\n", helpers)
+	helpers = fmt.Sprintf("%sfunc (m *%s) callCount(method string) (int, bool) {\n", helpers, mockName)
+	helpers = fmt.Sprintf("%s\tswitch method {\n", helpers)
+	for _, m := range i.Methods {
+		helpers = fmt.Sprintf("%s\tcase \"%s\":\n\t\treturn len(m.Calls.%s), true\n", helpers, m.Name, m.Name)
+	}
+	helpers = fmt.Sprintf("%s\t}\n", helpers)
+	helpers = fmt.Sprintf("%s\treturn 0, false\n}\n\n", helpers)
+
+	helpers = fmt.Sprintf("%s// notifyCall wakes up everything in WaitForCalls. The caller holds m.mu.\n", helpers)
+	helpers = fmt.Sprintf("%sfunc (m *%s) notifyCall() {\n", helpers, mockName)
+	helpers = fmt.Sprintf("%s\tif m.notify != nil {\n\t\tclose(m.notify)\n\t\tm.notify = nil\n\t}\n}\n", helpers)
+
+	return helpers
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"go/format"
+	"go/scanner"
+	"os"
+	"strings"
+)
+
+// snippetContext is how many lines around a bad line are shown.
+const snippetContext = 2
+
+// writeGoFile adds the import block generated code needs, gofmts it and writes it to output.
+// Code that doesn't parse is not written; the error points at the bad line of the generated code.
+func writeGoFile(output string, src string, imports *importSet) error {
+	withImports, err := addImports(src, imports)
+	if err != nil {
+		return generatedCodeError(output, src, err)
+	}
+
+	formatted, err := format.Source([]byte(withImports))
+	if err != nil {
+		return generatedCodeError(output, withImports, err)
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(formatted)
+	return err
+}
+
+// generatedCodeError reports where generated code failed to parse, with the lines around it.
+func generatedCodeError(output string, src string, err error) error {
+	errList, success := err.(scanner.ErrorList)
+	if !success || len(errList) == 0 {
+		return fmt.Errorf("%s: generated code is invalid: %v", output, err)
+	}
+
+	first := errList[0]
+	lines := strings.Split(src, "\n")
+	snippet := []string{}
+	for line := first.Pos.Line - snippetContext; line <= first.Pos.Line+snippetContext; line++ {
+		if line < 1 || line > len(lines) {
+			continue
+		}
+		marker := "  "
+		if line == first.Pos.Line {
+			marker = "> "
+		}
+		snippet = append(snippet, fmt.Sprintf("%s%4d | %s", marker, line, lines[line-1]))
+	}
+
+	return fmt.Errorf("%s:%d:%d: generated code is invalid: %s\n%s", output, first.Pos.Line, first.Pos.Column, first.Msg, strings.Join(snippet, "\n"))
+}
@@ -9,7 +9,8 @@ var AllPrimitives = []string{"bool", "string",
 	"float32", "float64",
 	"complex64", "complex128",
 	"error",
-	"interface"}
+	"interface",
+	"any", "comparable"}
 
 func IsPrimitive(vType string) bool {
 	for _, primitive := range AllPrimitives {
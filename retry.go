@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+)
+
+// noRetryDirective excludes a method from retries i.e. Store, which isn't safe to repeat.
+const noRetryDirective = "rawdog:noretry"
+
+// retryReservedNames are identifiers the generated retrying methods declare themselves.
+var retryReservedNames = []string{"s", "attempt"}
+
+// makeRetryDecorators writes Retrying<Name> and CircuitBreaking<Name> wrappers of the interfaces
+// in inFile. The RetryPolicy and CircuitBreaker they use are written to resilience.go next to outFile.
+func makeRetryDecorators(inFile string, outFile string, selected []string, outPackage string) error {
+	build := func(i Interface) string {
+		return fmt.Sprintf("%s\n%s", buildRetryingDecorator(i), buildCircuitBreakingDecorator(i))
+	}
+	if err := writeSupportFile(outFile, outPackage, "resilience.go", resilienceTemplate, newImportSet()); err != nil {
+		return err
+	}
+	return makeDecorators(inFile, outFile, selected, outPackage, build)
+}
+
+func buildRetryingDecorator(i Interface) string {
+	name := decoratorName("Retrying", i)
+	receiverName := name + typeParamNames(i.TypeParams)
+	ifaceType := interfaceType(i)
+
+	dec := fmt.Sprintf("// %s retries the failed calls to the %s it wraps according to its policy.\n", name, i.Name)
+	dec = fmt.Sprintf("%s// Methods annotated //%s are called once.\n", dec, noRetryDirective)
+	dec = fmt.Sprintf("%stype %s%s struct {\n", dec, name, typeParamDecl(i.TypeParams))
+	dec = fmt.Sprintf("%s\tnext   %s\n\tpolicy RetryPolicy\n}\n\n", dec, ifaceType)
+
+	dec = fmt.Sprintf("%s// New%s retries the calls to next that fail according to policy.\n", dec, name)
+	dec = fmt.Sprintf("%sfunc New%s%s(next %s, policy RetryPolicy) *%s {\n", dec, name, typeParamDecl(i.TypeParams), ifaceType, receiverName)
+	dec = fmt.Sprintf("%s\treturn &%s{next: next, policy: policy}\n}\n", dec, receiverName)
+
+	for _, m := range i.Methods {
+		m = namedResults(namedParams(m, retryReservedNames), retryReservedNames)
+		dec = fmt.Sprintf("%s\n%s", dec, buildRetryingMethod(m, receiverName))
+	}
+	return dec
+}
+
+func buildRetryingMethod(m Method, receiverName string) string {
+	method := docComment(m.Doc, "")
+	method = fmt.Sprintf("%sfunc (s *%s) %s(%s)%s {\n", method, receiverName, m.Name, paramList(m), resultList(m.Returns, true))
+
+	err, success := errorResult(m)
+	if !success || hasDirective(m, noRetryDirective) {
+		if len(m.Returns) == 0 {
+			return fmt.Sprintf("%s\ts.next.%s(%s)\n}\n", method, m.Name, argList(m))
+		}
+		return fmt.Sprintf("%s\treturn s.next.%s(%s)\n}\n", method, m.Name, argList(m))
+	}
+
+	ctx := "context.Background()"
+	if p, success := contextParam(m); success {
+		ctx = p.Name
+	}
+	method = fmt.Sprintf("%s\tfor attempt := 1; ; attempt++ {\n", method)
+	method = fmt.Sprintf("%s\t\t%s = s.next.%s(%s)\n", method, returnNames(m), m.Name, argList(m))
+	method = fmt.Sprintf("%s\t\tif !s.policy.retry(%s, attempt, %s) {\n", method, ctx, err.Name)
+	method = fmt.Sprintf("%s\t\t\treturn %s\n\t\t}\n\t}\n}\n", method, returnNames(m))
+	return method
+}
+
+func buildCircuitBreakingDecorator(i Interface) string {
+	name := decoratorName("CircuitBreaking", i)
+	receiverName := name + typeParamNames(i.TypeParams)
+	ifaceType := interfaceType(i)
+
+	dec := fmt.Sprintf("// %s fails the calls to the %s it wraps fast with ErrCircuitOpen while its breaker is open.\n", name, i.Name)
+	dec = fmt.Sprintf("%stype %s%s struct {\n", dec, name, typeParamDecl(i.TypeParams))
+	dec = fmt.Sprintf("%s\tnext    %s\n\tbreaker *CircuitBreaker\n}\n\n", dec, ifaceType)
+
+	dec = fmt.Sprintf("%s// New%s guards the calls to next with breaker, which may be shared with other wrappers.\n", dec, name)
+	dec = fmt.Sprintf("%sfunc New%s%s(next %s, breaker *CircuitBreaker) *%s {\n", dec, name, typeParamDecl(i.TypeParams), ifaceType, receiverName)
+	dec = fmt.Sprintf("%s\treturn &%s{next: next, breaker: breaker}\n}\n", dec, receiverName)
+
+	for _, m := range i.Methods {
+		m = namedResults(namedParams(m, retryReservedNames), retryReservedNames)
+		dec = fmt.Sprintf("%s\n%s", dec, buildCircuitBreakingMethod(m, receiverName))
+	}
+	return dec
+}
+
+func buildCircuitBreakingMethod(m Method, receiverName string) string {
+	method := docComment(m.Doc, "")
+	method = fmt.Sprintf("%sfunc (s *%s) %s(%s)%s {\n", method, receiverName, m.Name, paramList(m), resultList(m.Returns, true))
+
+	err, success := errorResult(m)
+	if !success { // nothing to fail fast with
+		if len(m.Returns) == 0 {
+			return fmt.Sprintf("%s\ts.next.%s(%s)\n}\n", method, m.Name, argList(m))
+		}
+		return fmt.Sprintf("%s\treturn s.next.%s(%s)\n}\n", method, m.Name, argList(m))
+	}
+
+	method = fmt.Sprintf("%s\tif !s.breaker.allow() {\n", method)
+	method = fmt.Sprintf("%s\t\t%s = ErrCircuitOpen\n\t\treturn %s\n\t}\n", method, err.Name, returnNames(m))
+	method = fmt.Sprintf("%s\t%s = s.next.%s(%s)\n", method, returnNames(m), m.Name, argList(m))
+	method = fmt.Sprintf("%s\ts.breaker.record(%s)\n", method, err.Name)
+	method = fmt.Sprintf("%s\treturn %s\n}\n", method, returnNames(m))
+	return method
+}
+
+const resilienceTemplate = `// RetryPolicy says how retrying decorators retry failed calls.
+type RetryPolicy struct {
+	MaxAttempts int                             // calls made at most, including the first
+	Backoff     func(attempt int) time.Duration // wait after the given failed attempt, none when nil
+	Retryable   func(err error) bool            // errors worth retrying, all of them when nil
+}
+
+// ExponentialBackoff doubles the wait after every failed attempt, starting at base.
+func ExponentialBackoff(base time.Duration) func(attempt int) time.Duration {
+	return func(attempt int) time.Duration {
+		return base << (attempt - 1)
+	}
+}
+
+// retry reports whether the call that failed with err on the given attempt should be made
+// again, once the backoff has passed or ctx is done.
+func (p RetryPolicy) retry(ctx context.Context, attempt int, err error) bool {
+	if err == nil || attempt >= p.MaxAttempts || (p.Retryable != nil && !p.Retryable(err)) {
+		return false
+	}
+	if p.Backoff == nil {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(p.Backoff(attempt))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// ErrCircuitOpen is returned instead of calling through a circuit breaker that is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitBreaker opens after Threshold calls in a row failed, failing calls fast until Cooldown
+// has passed. Then it lets calls through again, opening right away if the next one fails too.
+type CircuitBreaker struct {
+	Threshold int
+	Cooldown  time.Duration
+	IsFailure func(err error) bool // errors that count as failures, all of them when nil
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+}
+
+// NewCircuitBreaker opens after threshold failed calls in a row, for cooldown.
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{Threshold: threshold, Cooldown: cooldown}
+}
+
+func (b *CircuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failures < b.Threshold || time.Since(b.openedAt) >= b.Cooldown
+}
+
+func (b *CircuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil || (b.IsFailure != nil && !b.IsFailure(err)) {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.Threshold {
+		b.openedAt = time.Now()
+	}
+}
+`
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// routerTarget is a router the generated controllers can add their routes to. The routes of a
+// controller are the same for every router, paths included i.e. /%route%/:id, the target only
+// decides how they're registered and how the handlers read the params of their paths.
+type routerTarget struct {
+	Name       string
+	Package    string // the generated code refers to, "" for net/http
+	ImportPath string
+	Receiver   string // the AddRoutes param routes are added to, "" for a package level router
+	Route      func(method string, path string, handlerName string) string
+	Param      func(name string) string
+
+	// how the generated tests serve the routes
+	NewRouter string // makes a router to add the routes to, "" for a package level router
+	Instance  string // serves the routes of a package level router
+}
+
+// routerTargets are the routers rawdog -c -router can generate controllers for.
+var routerTargets = map[string]routerTarget{
+	"lib": {
+		Name:       "lib",
+		Package:    "router",
+		ImportPath: appImports["router"],
+		Route: func(method string, path string, handlerName string) string {
+			return fmt.Sprintf("router.%s(APIV1+\"%s\", h.%s)", method, path, handlerName)
+		},
+		Param: func(name string) string {
+			return fmt.Sprintf("router.Param(r, \"%s\")", name)
+		},
+		Instance: "router.Instance()",
+	},
+	"stdlib": {
+		Name:     "stdlib",
+		Receiver: "mux *http.ServeMux",
+		Route: func(method string, path string, handlerName string) string {
+			return fmt.Sprintf("mux.HandleFunc(\"%s \"+APIV1+\"%s\", h.%s)", strings.ToUpper(method), bracedParams(path), handlerName)
+		},
+		Param: func(name string) string {
+			return fmt.Sprintf("r.PathValue(\"%s\")", name)
+		},
+		NewRouter: "http.NewServeMux()",
+	},
+	"chi": {
+		Name:       "chi",
+		Package:    "chi",
+		ImportPath: "github.com/go-chi/chi/v5",
+		Receiver:   "router chi.Router",
+		Route: func(method string, path string, handlerName string) string {
+			return fmt.Sprintf("router.%s(APIV1+\"%s\", h.%s)", method, bracedParams(path), handlerName)
+		},
+		Param: func(name string) string {
+			return fmt.Sprintf("chi.URLParam(r, \"%s\")", name)
+		},
+		NewRouter: "chi.NewRouter()",
+	},
+	"gorilla": {
+		Name:       "gorilla",
+		Package:    "mux",
+		ImportPath: "github.com/gorilla/mux",
+		Receiver:   "router *mux.Router",
+		Route: func(method string, path string, handlerName string) string {
+			return fmt.Sprintf("router.HandleFunc(APIV1+\"%s\", h.%s).Methods(http.Method%s)", bracedParams(path), handlerName, method)
+		},
+		Param: func(name string) string {
+			return fmt.Sprintf("mux.Vars(r)[\"%s\"]", name)
+		},
+		NewRouter: "mux.NewRouter()",
+	},
+}
+
+// findRouterTarget finds the router called name.
+func findRouterTarget(name string) (routerTarget, error) {
+	target, success := routerTargets[name]
+	if !success {
+		return routerTarget{}, fmt.Errorf("there's no router %s, pick one of %s", name, strings.Join(routerTargetNames(), ", "))
+	}
+	return target, nil
+}
+
+func routerTargetNames() []string {
+	names := []string{}
+	for name := range routerTargets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// bracedParams writes the params of a path in braces i.e. /%route%/{id} for /%route%/:id
+func bracedParams(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
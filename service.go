@@ -5,19 +5,20 @@ import (
 	"go/ast"
 	"go/parser"
 	"go/token"
-	"os"
 	"strings"
 )
 
-func makeService(modelFile string, serviceFile string) {
+// makeService writes the service and repo interfaces of the queries in modelFile, a service
+// forwarding to the repo and the tests of the service next to it. withContext makes every
+// method take a context first.
+func makeService(modelFile string, serviceFile string, withContext bool) error {
 	input := modelFile
 	output := serviceFile
 
-	fset := token.NewFileSet()                      // positions are relative to fset
-	f, err := parser.ParseFile(fset, input, nil, 0) //parser.Trace
+	fset := token.NewFileSet()                                         // positions are relative to fset
+	f, err := parser.ParseFile(fset, input, nil, parser.ParseComments) //parser.Trace
 	if err != nil {
-		fmt.Println(err)
-		return
+		return err
 	}
 	methods := []Method{}
 	// packageName := f.Name.Name
@@ -25,49 +26,22 @@ func makeService(modelFile string, serviceFile string) {
 	serviceName := ""
 	for _, decl := range f.Decls {
 		funcDecl, success := decl.(*ast.FuncDecl)
-		if !success || funcDecl.Recv == nil {
+		if !success {
 			continue
 		}
 
-		isServiceFunc := false
-		for _, field := range funcDecl.Recv.List {
-			recPtr, success := field.Type.(*ast.StarExpr)
-			if !success {
-				continue
-			}
-
-			// found a function
-			x, success := recPtr.X.(*ast.Ident)
-			if !success {
-				continue
-			}
-
-			// if the receiver pointer ends with 'service' then it must be the type we're looking for
-			if !strings.HasSuffix(x.Name, "Service") {
-				continue
-			}
-			serviceName = x.Name
-
-			isServiceFunc = true
-		}
-
-		if !isServiceFunc {
+		// if the receiver pointer ends with 'service' then it must be the type we're looking for
+		recv, isPointer := receiverType(funcDecl)
+		if !isPointer || !strings.HasSuffix(recv, "Service") {
 			continue
 		}
-		meth := Method{}
-		meth.Name = funcDecl.Name.Name
-
-		ftype := funcDecl.Type
-		packageName := "domain"
-		for _, param := range ftype.Params.List { //method params
-			p := paramFromMember(param, packageName)
-			meth.Params = append(meth.Params, p...)
-		}
-		for _, result := range ftype.Results.List {
-			r := paramFromMember(result, packageName)
-			meth.Returns = append(meth.Returns, r...)
+		serviceName = recv
+
+		m := methodFromFunc(funcDecl, "domain", nil)
+		if withContext {
+			m = withContextParam(m)
 		}
-		methods = append(methods, meth)
+		methods = append(methods, m)
 	}
 	items := strings.Split(serviceName, "Service")
 	domainType := items[0]
@@ -80,14 +54,31 @@ func makeService(modelFile string, serviceFile string) {
 
 	serviceOut := fmt.Sprintf("package logic\n%v\n%v\n%v\n%v\n%v", svcInt, repoInt, str, cstr, impl)
 
-	file, err := os.Create(output)
-	if err != nil {
-		fmt.Printf("ERROR: %v\n", err)
-		return
+	imports := newImportSet()
+	imports.addFile(f)
+	imports.addAll(appImports)
+	if err := writeGoFile(output, serviceOut, imports); err != nil {
+		return err
+	}
+
+	// the service only forwards to the repo, so its tests can be generated along with it
+	testFile := strings.TrimSuffix(output, ".go") + "_test.go"
+	if handWritten(testFile) {
+		fmt.Printf("WARNING: %s wasn't generated by rawdog, not overwriting it\n", testFile)
+		return nil
 	}
-	defer file.Close()
+	testOut := fmt.Sprintf("// Generated by Rawdog\n\npackage logic\n\n%s", ServiceTests(methods, domainType+"Repo", domainType+"Service"))
+	return writeGoFile(testFile, testOut, imports)
+}
 
-	file.WriteString(serviceOut)
+// withContextParam makes m take ctx context.Context first, unless it already takes a context.
+func withContextParam(m Method) Method {
+	if _, success := contextParam(m); success {
+		return m
+	}
+	ctx := Param{Name: "ctx", Type: "context.Context", Kind: GoInterface}
+	m.Params = append([]Param{ctx}, m.Params...)
+	return m
 }
 
 func Struct(repoName string, serviceName string) string {
@@ -116,39 +107,73 @@ func ConformInterface(methods []Method, serviceName string) string {
 	return conform
 }
 
+// MethodKind is what a repo or service method does, going by the names of the generated queries.
+type MethodKind int
+
+const (
+	OtherMethod  MethodKind = iota
+	AllMethod               // All, AllAugmented
+	ByMethod                // ByID, ByOrgID, ByIDAugmented
+	StoreMethod             // Store
+	UpdateMethod            // Update, Patch
+	DeleteMethod            // DeleteByID
+)
+
+func methodKindFor(name string) MethodKind {
+	switch {
+	case strings.HasPrefix(name, "All"):
+		return AllMethod
+	case strings.HasPrefix(name, "By"):
+		return ByMethod
+	case name == "Store":
+		return StoreMethod
+	case name == "Update" || name == "Patch":
+		return UpdateMethod
+	case name == "DeleteByID":
+		return DeleteMethod
+	}
+	return OtherMethod
+}
+
 func InterfaceConformance(m Method, serviceName string) string {
 	paramString := []string{}
-	returnString := []string{}
 	callString := []string{}
 	for _, p := range m.Params {
 		paramString = append(paramString, p.Name+" "+p.Type)
-		callString = append(callString, p.Name)
+		if p.Kind == Variadic {
+			callString = append(callString, p.Name+"...")
+		} else {
+			callString = append(callString, p.Name)
+		}
 	}
 	calls := strings.Join(callString, ", ")
 	params := strings.Join(paramString, ", ")
 
-	returnsString := []string{}
-	for _, r := range m.Returns {
-		returnString = append(returnString, r.Type)
-
-		ret := ZeroValueFor(r.Kind, r.Type)
-
-		returnsString = append(returnsString, ret)
-	}
-	returns := strings.Join(returnString, ", ")
 	commentStr := fmt.Sprintf("%s", m.Name)
-	if strings.HasPrefix(commentStr, "All") {
+	switch methodKindFor(m.Name) {
+	case AllMethod:
 		commentStr = fmt.Sprintf("%s gets all %s.", commentStr, serviceName)
-	} else if strings.HasPrefix(commentStr, "By") {
+	case ByMethod:
 		commentStr = fmt.Sprintf("%s gets %s by %s.", commentStr, serviceName, commentStr[2:])
-	} else if commentStr == "Store" {
+	case StoreMethod:
 		commentStr = fmt.Sprintf("%s stores a %s record.", commentStr, serviceName)
-	} else if commentStr == "DeleteByID" {
+	case UpdateMethod:
+		commentStr = fmt.Sprintf("%s changes a %s record.", commentStr, serviceName)
+	case DeleteMethod:
 		commentStr = fmt.Sprintf("%s marks a %s record as deleted.", commentStr, serviceName)
 	}
 
-	method := fmt.Sprintf("// %s \nfunc (s *%s) %s(%s) (%s) {\n", commentStr, serviceName, m.Name, params, returns)
-	method = fmt.Sprintf("%s\treturn s.repo.%s(%s)\n}\n", method, m.Name, calls)
+	comment := fmt.Sprintf("// %s \n", commentStr)
+	if len(m.Doc) > 0 {
+		comment = docComment(m.Doc, "")
+	}
+
+	method := fmt.Sprintf("%sfunc (s *%s) %s(%s)%s {\n", comment, serviceName, m.Name, params, resultList(m.Returns, true))
+	if len(m.Returns) == 0 {
+		method = fmt.Sprintf("%s\ts.repo.%s(%s)\n}\n", method, m.Name, calls)
+	} else {
+		method = fmt.Sprintf("%s\treturn s.repo.%s(%s)\n}\n", method, m.Name, calls)
+	}
 
 	return method
 }
@@ -163,7 +188,7 @@ func ServiceInterface(methods []Method, serviceName string) string {
 	serviceInterfaceStr = fmt.Sprintf("%stype I%s interface {\n", serviceInterfaceStr, serviceName)
 	for _, method := range methods {
 		iMethodStr := InterfaceMethod(serviceName, method)
-		serviceInterfaceStr = fmt.Sprintf("%s\t%s", serviceInterfaceStr, iMethodStr)
+		serviceInterfaceStr = fmt.Sprintf("%s%s%s\t%s", serviceInterfaceStr, docComment(method.Doc, "\t"), directiveComment(method.Directives, "\t"), iMethodStr)
 	}
 	serviceInterfaceStr = fmt.Sprintf("%s}\n\n", serviceInterfaceStr)
 	return serviceInterfaceStr
@@ -171,22 +196,11 @@ func ServiceInterface(methods []Method, serviceName string) string {
 
 func InterfaceMethod(serviceName string, m Method) string {
 	paramString := []string{}
-	returnString := []string{}
 	for _, p := range m.Params {
 		paramString = append(paramString, p.Name+" "+p.Type)
 	}
 	params := strings.Join(paramString, ", ")
 
-	returnsString := []string{}
-	for _, r := range m.Returns {
-		returnString = append(returnString, r.Type)
-
-		ret := ZeroValueFor(r.Kind, r.Type)
-
-		returnsString = append(returnsString, ret)
-	}
-	returns := strings.Join(returnString, ", ")
-
-	method := fmt.Sprintf("%s(%s) (%s)\n", m.Name, params, returns)
+	method := fmt.Sprintf("%s(%s)%s\n", m.Name, params, resultList(m.Returns, true))
 	return method
 }
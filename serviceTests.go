@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// serviceTestReservedNames are identifiers the generated service tests declare themselves.
+var serviceTestReservedNames = []string{"t", "s", "repo", "err", "wantErr"}
+
+// ServiceTests tests that every method of the service forwards its arguments to a mock of the
+// repo and returns what the repo returned, errors included.
+func ServiceTests(methods []Method, repoName string, serviceName string) string {
+	// buildMock names the results of the methods it's given in place. The mock is unexported
+	// so it can't clash with one rawdog -m writes to the package
+	repoMethods := append([]Method(nil), methods...)
+	repo := Interface{Name: "I" + repoName, Methods: repoMethods, MockName: "testI" + repoName}
+	tests := buildMock(repo, MockOptions{})
+
+	for _, m := range methods {
+		m = namedParams(m, serviceTestReservedNames)
+		tests = fmt.Sprintf("%s\n%s", tests, ServiceMethodTest(m, repo, serviceName, false))
+		if _, success := errorResult(m); success {
+			tests = fmt.Sprintf("%s\n%s", tests, ServiceMethodTest(m, repo, serviceName, true))
+		}
+	}
+	return tests
+}
+
+// ServiceMethodTest calls the service method m and checks what reached the repo and what came
+// back. failing makes the repo return an error along with its other results.
+func ServiceMethodTest(m Method, repo Interface, serviceName string, failing bool) string {
+	testName := fmt.Sprintf("Test%s%s", serviceName, m.Name)
+	doc := fmt.Sprintf("// %s checks %s forwards its arguments to the repo and returns what it returns.\n", testName, m.Name)
+	if len(m.Returns) == 0 {
+		doc = fmt.Sprintf("// %s checks %s forwards its arguments to the repo.\n", testName, m.Name)
+	}
+	if failing {
+		testName = testName + "Error"
+		doc = fmt.Sprintf("// %s checks %s returns the error of the repo unchanged.\n", testName, m.Name)
+	}
+
+	test := fmt.Sprintf("%sfunc %s(t *testing.T) {\n", doc, testName)
+	for _, p := range m.Params {
+		test = fmt.Sprintf("%s\t%s\n", test, sampleDecl(p, p.Name))
+	}
+
+	err, hasError := errorResult(m)
+	wants := []string{}
+	gots := []string{}
+	for idx, r := range m.Returns {
+		if hasError && idx == len(m.Returns)-1 {
+			wants = append(wants, "wantErr")
+			gots = append(gots, "err")
+			continue
+		}
+		test = fmt.Sprintf("%s\t%s\n", test, sampleDecl(r, fmt.Sprintf("want%d", idx)))
+		wants = append(wants, fmt.Sprintf("want%d", idx))
+		gots = append(gots, fmt.Sprintf("got%d", idx))
+	}
+	if hasError {
+		if failing {
+			test = fmt.Sprintf("%s\twantErr := errors.New(\"%s failed\")\n", test, m.Name)
+		} else {
+			test = fmt.Sprintf("%s\tvar wantErr %s\n", test, err.Type)
+		}
+	}
+
+	test = fmt.Sprintf("%s\trepo := &%s{}\n", test, mockNameFor(repo))
+	if len(m.Returns) > 0 {
+		test = fmt.Sprintf("%s\trepo.%sReturns(%s)\n", test, m.Name, strings.Join(wants, ", "))
+	}
+	test = fmt.Sprintf("%s\ts := New%s(repo)\n\n", test, serviceName)
+
+	if len(m.Returns) > 0 {
+		test = fmt.Sprintf("%s\t%s := s.%s(%s)\n", test, strings.Join(gots, ", "), m.Name, argList(m))
+	} else {
+		test = fmt.Sprintf("%s\ts.%s(%s)\n", test, m.Name, argList(m))
+	}
+	args := []string{"t"}
+	for _, p := range m.Params {
+		if p.Kind == Variadic {
+			args = append(args, p.Name+"...")
+		} else {
+			args = append(args, p.Name)
+		}
+	}
+	test = fmt.Sprintf("%s\trepo.Assert%sCalledWith(%s)\n", test, m.Name, strings.Join(args, ", "))
+	for idx := range m.Returns {
+		test = fmt.Sprintf("%s\tassert.Equal(t, %s, %s)\n", test, wants[idx], gots[idx])
+	}
+	return fmt.Sprintf("%s}\n", test)
+}
+
+// sampleDecl declares name as a value of the type of p that's easy to tell apart from its zero
+// value where possible, so a test can check the value is passed along as is.
+func sampleDecl(p Param, name string) string {
+	switch {
+	case p.Type == "context.Context":
+		return fmt.Sprintf("%s := context.Background()", name)
+	case p.Type == "error":
+		return fmt.Sprintf("%s := errors.New(\"test%s\")", name, name)
+	case p.Type == "string":
+		return fmt.Sprintf("%s := \"test%s\"", name, name)
+	case p.Type == "bool":
+		return fmt.Sprintf("%s := true", name)
+	case p.Type == "int":
+		return fmt.Sprintf("%s := 1", name)
+	case p.Type == "float64":
+		return fmt.Sprintf("%s := 1000.0", name)
+	case p.Kind == Pointer:
+		return fmt.Sprintf("%s := new(%s)", name, strings.TrimPrefix(p.Type, "*"))
+	case p.Kind == Slice:
+		return fmt.Sprintf("%s := make(%s, 1)", name, p.Type)
+	case p.Kind == Map:
+		return fmt.Sprintf("%s := %s{}", name, p.Type)
+	case p.Kind == Variadic:
+		return fmt.Sprintf("%s := make([]%s, 1)", name, strings.TrimPrefix(p.Type, "..."))
+	}
+	return fmt.Sprintf("var %s %s", name, p.Type)
+}
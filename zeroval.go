@@ -54,5 +54,17 @@ func ZeroValueFor(kind VariableKind, vType string) string {
 		return "nil"
 	}
 
+	if kind == Map || kind == Chan || kind == Func {
+		return "nil"
+	}
+
+	if kind == Array || kind == GoStruct {
+		return vType + "{}" // [4]byte{} or struct{}{}
+	}
+
+	if kind == TypeParam || kind == NamedBasic {
+		return fmt.Sprintf("*new(%s)", vType) // no literal zero value without knowing the underlying type
+	}
+
 	return "nil"
 }